@@ -2,20 +2,31 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	admin "github.com/silverswords/cerebus/pkg/admin/controller"
 	"github.com/silverswords/cerebus/pkg/scheduler"
 	script "github.com/silverswords/cerebus/pkg/script/controller"
+	scriptmodel "github.com/silverswords/cerebus/pkg/script/model"
+	"github.com/silverswords/cerebus/pkg/script/runner"
 	task "github.com/silverswords/cerebus/pkg/task/controller"
+	taskmodel "github.com/silverswords/cerebus/pkg/task/model"
 )
 
 func main() {
+	migrateTypes := flag.Bool("migrate-script-types", false, "migrate the scripts of the legacy types to their runners and exit")
+	flag.Parse()
+
 	router := gin.Default()
 	router.Use(Cors())
 
@@ -29,6 +40,15 @@ func main() {
 	}
 	defer db.Close()
 
+	if *migrateTypes {
+		migrated, err := scriptmodel.MigrateTypes(db, runner.LegacyTypes)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("%d scripts of the legacy types are migrated\n", migrated)
+		return
+	}
+
 	endpoint := "server:9000"
 	accessKeyID := "minioadmin"
 	secretAccessKey := "minioadmin"
@@ -41,13 +61,41 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	sche := scheduler.New()
-	go sche.Start(2)
-	scriptController := script.New(db)
-	taskController := task.New(db, sche, minioClient)
+	sche := scheduler.New(
+		scheduler.WithQueue(scheduler.NewBoundedQueue(1024, scheduler.Reject)),
+		scheduler.WithWorkers(2),
+		scheduler.WithAutoscaler(scheduler.AutoscaleConfig{
+			Min:        1,
+			Max:        8,
+			TargetWait: 30 * time.Second,
+			IdleAfter:  5 * time.Minute,
+			Cooldown:   30 * time.Second,
+		}),
+		scheduler.WithStallTimeout(10*time.Minute),
+		scheduler.WithDeadlineAdmission(),
+		scheduler.WithLoadShedding(time.Hour),
+		scheduler.WithCheckpointStore(taskmodel.NewCheckpointStore(db)),
+	)
+	go sche.Start(0)
+	runners := runner.Default()
+	scriptController := script.New(db, runners)
+	taskController := task.New(db, sche, minioClient, runners)
+	// the hosts the embedded scripts can fetch, comma separated
+	taskController.AllowHosts(strings.Split(os.Getenv("CEREBUS_FETCH_HOSTS"), ",")...)
+	// the scripts can be submitted as task specs to /admin/scheduler/submit
+	if err := taskController.RegisterHandlers(sche.Registry()); err != nil {
+		log.Fatalln(err)
+	}
+	adminController := admin.New(sche)
 
 	scriptController.RegisterRouter(router)
 	taskController.RegisterRouter(router)
+	adminController.RegisterRouter(router)
+
+	// the tasks were running when the server stopped resume from their checkpoints
+	if err := taskController.Recover(); err != nil {
+		log.Fatalln(err)
+	}
 
 	log.Fatal(router.Run("0.0.0.0:10001"))
 	sche.Wait()
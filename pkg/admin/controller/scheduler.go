@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silverswords/cerebus/pkg/scheduler"
+)
+
+// retryAfter is the delay suggested to clients when the scheduler is saturated
+var retryAfter = 5 * time.Second
+
+type SchedulerController struct {
+	sche *scheduler.Scheduler
+}
+
+func New(sche *scheduler.Scheduler) *SchedulerController {
+	return &SchedulerController{
+		sche: sche,
+	}
+}
+
+func (sc *SchedulerController) RegisterRouter(r gin.IRouter) {
+	r.GET("/admin/scheduler", sc.snapshot)
+	r.POST("/admin/scheduler/pause", sc.pause)
+	r.POST("/admin/scheduler/resume", sc.resume)
+	r.POST("/admin/scheduler/resize", sc.resize)
+	r.POST("/admin/scheduler/cancel", sc.cancel)
+	r.POST("/admin/scheduler/submit", sc.submit)
+	r.GET("/admin/scheduler/handlers", sc.handlers)
+	r.GET("/admin/faults", sc.faults)
+	r.POST("/admin/faults/enable", sc.enableFaults)
+	r.POST("/admin/faults/disable", sc.disableFaults)
+	r.POST("/admin/faults/rules", sc.faultRules)
+}
+
+func (sc *SchedulerController) snapshot(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "scheduler": sc.sche.Snapshot()})
+}
+
+func (sc *SchedulerController) pause(c *gin.Context) {
+	sc.sche.Pause()
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (sc *SchedulerController) resume(c *gin.Context) {
+	sc.sche.Resume()
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (sc *SchedulerController) resize(c *gin.Context) {
+	var req struct {
+		Workers *int `json:"workers,omitempty" binding:"required,min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	sc.sche.Resize(*req.Workers)
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "workers": sc.sche.Workers()})
+}
+
+func (sc *SchedulerController) cancel(c *gin.Context) {
+	var req struct {
+		ID string `json:"id,omitempty" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if err := sc.sche.Cancel(req.ID); err != nil {
+		c.Error(err)
+		if errors.Is(err, scheduler.ErrTaskNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (sc *SchedulerController) faults(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "faults": sc.sche.Faults().Status()})
+}
+
+func (sc *SchedulerController) enableFaults(c *gin.Context) {
+	sc.sche.Faults().Enable()
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (sc *SchedulerController) disableFaults(c *gin.Context) {
+	sc.sche.Faults().Disable()
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (sc *SchedulerController) faultRules(c *gin.Context) {
+	var req struct {
+		Rules []scheduler.FaultRule `json:"rules"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if err := sc.sche.Faults().SetRules(req.Rules); err != nil {
+		c.Error(err)
+		if errors.Is(err, scheduler.ErrInvalidFault) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "faults": sc.sche.Faults().Status()})
+}
+
+func (sc *SchedulerController) submit(c *gin.Context) {
+	var spec scheduler.TaskSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	id, err := sc.sche.Submit(spec)
+	if err != nil {
+		c.Error(err)
+		switch {
+		case errors.Is(err, scheduler.ErrTaskNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+		case errors.Is(err, scheduler.ErrDuplicateTask):
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+		case errors.Is(err, scheduler.ErrQueueFull):
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"status": http.StatusTooManyRequests})
+		case errors.Is(err, scheduler.ErrUnknownHandler) || errors.Is(err, scheduler.ErrInvalidSpec) ||
+			errors.Is(err, scheduler.ErrExceedsCapacity) || errors.Is(err, scheduler.ErrUnschedulable) ||
+			errors.Is(err, scheduler.ErrInvalidCalendar) || errors.Is(err, scheduler.ErrDeadlineUnmeetable):
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "id": id})
+}
+
+func (sc *SchedulerController) handlers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "handlers": sc.sche.Registry().Names()})
+}
@@ -0,0 +1,279 @@
+package scheduler
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// runWeight is the weight of the latest run in the average run time
+const runWeight = 0.2
+
+// QueuedTask is a waiting task in a Snapshot
+type QueuedTask struct {
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id,omitempty"`
+	Handler  string    `json:"handler,omitempty"`
+	Priority int       `json:"priority"`
+	Attempt  uint      `json:"attempt"`
+	Deadline time.Time `json:"deadline,omitempty"`
+	// EligibleAt is when the calendars allow the task to run, zero if they allow it now
+	EligibleAt time.Time `json:"eligible_at,omitempty"`
+}
+
+// RunningTask is a running task in a Snapshot
+type RunningTask struct {
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id,omitempty"`
+	Handler  string    `json:"handler,omitempty"`
+	Worker   string    `json:"worker"`
+	Start    time.Time `json:"start"`
+	Attempt  uint      `json:"attempt"`
+	Progress float64   `json:"progress"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// Snapshot is the state of a scheduler at a moment
+type Snapshot struct {
+	Time      time.Time     `json:"time"`
+	Paused    bool          `json:"paused"`
+	Workers   int           `json:"workers"`
+	Deadlines DeadlineStats `json:"deadlines"`
+	// Queued are the waiting tasks in dispatch order, the tasks with ParentID form the trees
+	// of the spawned tasks
+	Queued  []QueuedTask  `json:"queued"`
+	Running []RunningTask `json:"running"`
+}
+
+// Snapshot returns the waiting and running tasks
+func (s *Scheduler) Snapshot() Snapshot {
+	now := s.clock.Now()
+	snapshot := Snapshot{
+		Time:      now,
+		Paused:    s.Paused(),
+		Workers:   s.Workers(),
+		Deadlines: s.DeadlineStats(),
+		Queued:    []QueuedTask{},
+		Running:   []RunningTask{},
+	}
+
+	for _, t := range s.queue.Tasks() {
+		realTask, ok := t.(*task)
+		if !ok {
+			continue
+		}
+
+		queued := QueuedTask{
+			ID:       realTask.id,
+			ParentID: realTask.parentID(),
+			Handler:  realTask.handler(),
+			Priority: realTask.priority,
+			Attempt:  realTask.attempts,
+			Deadline: realTask.deadline,
+		}
+		if !allowed(now, s.calendar, realTask.calendar) {
+			queued.EligibleAt, _ = nextEligible(now, s.calendar, realTask.calendar)
+		}
+		snapshot.Queued = append(snapshot.Queued, queued)
+	}
+
+	s.runMu.Lock()
+	executions := make([]*execution, 0, len(s.running))
+	for _, e := range s.running {
+		executions = append(executions, e)
+	}
+	s.runMu.Unlock()
+
+	for _, e := range executions {
+		e.mu.Lock()
+		snapshot.Running = append(snapshot.Running, RunningTask{
+			ID:       e.task.id,
+			ParentID: e.task.parentID(),
+			Handler:  e.task.handler(),
+			Worker:   e.worker,
+			Start:    e.start,
+			Attempt:  e.attempt,
+			Progress: e.progress,
+			Message:  e.message,
+		})
+		e.mu.Unlock()
+	}
+
+	return snapshot
+}
+
+// Estimate returns the position of the waiting task with id in the queue and a rough time it
+// starts, which assumes the tasks take the average run time so far
+func (s *Scheduler) Estimate(id string) (int, time.Time, error) {
+	now := s.clock.Now()
+	for i, t := range s.queue.Tasks() {
+		if realTask, ok := t.(*task); !ok || realTask.id != id {
+			continue
+		}
+
+		workers := s.Workers()
+		if workers <= 0 {
+			workers = 1
+		}
+
+		s.runMu.Lock()
+		running := len(s.running)
+		s.runMu.Unlock()
+
+		// the tasks have to finish before a worker is free for this one
+		ahead := i + running - workers + 1
+		if ahead <= 0 {
+			return i, now, nil
+		}
+
+		waves := (ahead + workers - 1) / workers
+		return i, now.Add(time.Duration(waves) * s.averageRun()), nil
+	}
+
+	return 0, time.Time{}, ErrTaskNotFound
+}
+
+// Pause stops dispatching tasks, the running ones go on
+func (s *Scheduler) Pause() {
+	atomic.StoreInt32(&s.paused, 1)
+	s.logger.Info("scheduler paused")
+}
+
+// Resume dispatches tasks again
+func (s *Scheduler) Resume() {
+	atomic.StoreInt32(&s.paused, 0)
+	s.logger.Info("scheduler resumed")
+	s.wake()
+}
+
+// Paused reports whether the scheduler is paused
+func (s *Scheduler) Paused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
+
+// Workers returns the number of the unlabeled workers
+func (s *Scheduler) Workers() int {
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+
+	return len(s.stopChs) - int(atomic.LoadInt64(&s.retiring))
+}
+
+// Resize changes the number of the unlabeled workers to n, the extra workers stop after
+// their current tasks. The autoscaler, if there is one, may resize them again later.
+func (s *Scheduler) Resize(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+
+	if s.isShutdown() {
+		return
+	}
+
+	size := len(s.stopChs) - int(atomic.LoadInt64(&s.retiring))
+	s.logger.Info("resize workers", "from", size, "to", n)
+
+	for ; size < n; size++ {
+		if atomic.LoadInt64(&s.retiring) > 0 {
+			atomic.AddInt64(&s.retiring, -1)
+			continue
+		}
+
+		stopCh := make(chan struct{})
+		s.stopChs = append(s.stopChs, stopCh)
+		s.startWorker(stopCh)
+	}
+
+	if size <= n {
+		return
+	}
+
+	if _, ok := s.queue.(*stealingQueue); ok {
+		// the workers pull tasks by themselves, they stop once they see the channel closed
+		for ; size > n; size-- {
+			last := len(s.stopChs) - 1
+			close(s.stopChs[last])
+			s.stopChs = s.stopChs[:last]
+		}
+		s.wake()
+		return
+	}
+
+	// the dispatcher stops the idle workers, so that no task is sent to a stopped one
+	atomic.AddInt64(&s.retiring, int64(size-n))
+	s.wake()
+}
+
+// retire stops an idle unlabeled worker if the workers are more than wanted, it returns the
+// idle workers left
+func (s *Scheduler) retire(idle []*goroutineWorker) []*goroutineWorker {
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+
+	for i := 0; i < len(idle) && atomic.LoadInt64(&s.retiring) > 0; {
+		w := idle[i]
+		if w.labels != nil || !s.forgetStopCh(w.stopCh) {
+			i++
+			continue
+		}
+
+		close(w.stopCh)
+		atomic.AddInt64(&s.retiring, -1)
+		idle = append(idle[:i], idle[i+1:]...)
+	}
+
+	return idle
+}
+
+// forgetStopCh removes stopCh from the workers can be resized, the caller must hold the lock
+func (s *Scheduler) forgetStopCh(stopCh chan struct{}) bool {
+	for i, c := range s.stopChs {
+		if c == stopCh {
+			s.stopChs = append(s.stopChs[:i], s.stopChs[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// stopWorkers stops all the workers can be resized
+func (s *Scheduler) stopWorkers() {
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+
+	for _, stopCh := range s.stopChs {
+		close(stopCh)
+	}
+	s.stopChs = nil
+	atomic.StoreInt64(&s.retiring, 0)
+}
+
+// observeRun counts d in the average run time
+func (s *Scheduler) observeRun(d time.Duration) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if s.avgRun == 0 {
+		s.avgRun = d
+		return
+	}
+
+	s.avgRun = time.Duration(runWeight*float64(d) + (1-runWeight)*float64(s.avgRun))
+}
+
+// averageRun returns the average run time of the tasks
+func (s *Scheduler) averageRun() time.Duration {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	return s.avgRun
+}
+
+// nextWorkerID returns an id for a new worker
+func (s *Scheduler) nextWorkerID() string {
+	return "worker-" + strconv.FormatUint(atomic.AddUint64(&s.workerSeq, 1), 10)
+}
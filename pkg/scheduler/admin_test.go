@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := New()
+	if err := s.SortByPriority(); err != nil {
+		t.Fatal(err)
+	}
+	go s.Start(1)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}).WithID("running"))
+	<-started
+
+	for _, p := range []int{3, 1, 2} {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return nil
+		}).WithPriority(p))
+	}
+
+	snapshot := s.Snapshot()
+	if len(snapshot.Running) != 1 || snapshot.Running[0].ID != "running" || snapshot.Running[0].Attempt != 1 ||
+		snapshot.Running[0].Worker == "" {
+		t.Errorf("running is unexpected: %+v", snapshot.Running)
+	}
+
+	if len(snapshot.Queued) != 3 {
+		t.Fatalf("queued are expected as 3, actually %d", len(snapshot.Queued))
+	}
+	for i, queued := range snapshot.Queued {
+		if queued.Priority != i+1 {
+			t.Errorf("priority of queued %d is expected as %d, actually %d", i, i+1, queued.Priority)
+		}
+	}
+
+	if snapshot.Workers != 1 {
+		t.Errorf("workers are expected as 1, actually %d", snapshot.Workers)
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+}
+
+func TestPause(t *testing.T) {
+	s := New()
+	s.Pause()
+	go s.Start(1)
+
+	done := make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(done)
+		return nil
+	}).WithID("paused"))
+
+	select {
+	case <-done:
+		t.Fatal("task isn't expected to run while the scheduler is paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	position, start, err := s.Estimate("paused")
+	if err != nil || position != 0 || start.IsZero() {
+		t.Errorf("estimate is unexpected: %d %v %v", position, start, err)
+	}
+
+	s.Resume()
+	<-done
+	s.Wait()
+	s.Stop()
+
+	if _, _, err := s.Estimate("paused"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error is expected as %v, actually %v", ErrTaskNotFound, err)
+	}
+}
+
+// watchWorkers returns the option makes each unlabeled worker signal on the channel once
+// it's created
+func watchWorkers() (Option, <-chan struct{}) {
+	started := make(chan struct{}, 16)
+	return WithWorkerFactory(func(s *Scheduler, stopCh chan struct{}) Worker {
+		started <- struct{}{}
+		return NewGoroutineWorker(s, stopCh)
+	}), started
+}
+
+func TestResize(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"dispatcher":    nil,
+		"work stealing": {WithWorkStealing(2)},
+	} {
+		watch, started := watchWorkers()
+		s := New(append(opts, watch)...)
+		go s.Start(1)
+		<-started
+
+		began := make(chan struct{})
+		release := make(chan struct{})
+		f := TaskFunc(func(ctx context.Context) error {
+			began <- struct{}{}
+			<-release
+			return nil
+		})
+
+		s.Resize(3)
+		for i := 0; i < 2; i++ {
+			<-started
+		}
+		for i := 0; i < 3; i++ {
+			s.Schedule(f)
+		}
+		for i := 0; i < 3; i++ {
+			<-began
+		}
+
+		s.Resize(1)
+		if workers := s.Workers(); workers != 1 {
+			t.Errorf("%s: workers are expected as 1, actually %d", name, workers)
+		}
+
+		close(release)
+		s.Wait()
+
+		// the tasks are released one by one, only one of them is running each time
+		release = make(chan struct{})
+		for i := 0; i < 3; i++ {
+			s.Schedule(f)
+		}
+		for i := 0; i < 3; i++ {
+			<-began
+			if snapshot := s.Snapshot(); len(snapshot.Running) != 1 || len(snapshot.Queued) != 2-i {
+				t.Errorf("%s: tasks are expected to run one by one after shrinking, actually %d running and %d queued",
+					name, len(snapshot.Running), len(snapshot.Queued))
+			}
+			release <- struct{}{}
+		}
+		s.Wait()
+		s.Stop()
+	}
+}
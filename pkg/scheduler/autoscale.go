@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"time"
+)
+
+// defaultAutoscaleInterval is how often the autoscaler checks the queue by default
+const defaultAutoscaleInterval = time.Second
+
+// AutoscaleConfig is the policy of the autoscaler, which resizes the unlabeled workers
+type AutoscaleConfig struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// TargetWait is the wait of the oldest waiting task over which the pool grows, 0 disables it
+	TargetWait time.Duration `json:"target_wait"`
+	// TargetDepth is the number of the waiting tasks over which the pool grows, 0 disables it
+	TargetDepth int `json:"target_depth"`
+	// IdleAfter is how long the queue stays empty with idle workers before the pool shrinks
+	IdleAfter time.Duration `json:"idle_after"`
+	// Cooldown is the least time between two resizes
+	Cooldown time.Duration `json:"cooldown"`
+	// Interval is how often the queue is checked, a second by default
+	Interval time.Duration `json:"interval"`
+}
+
+// WithAutoscaler makes the scheduler grow the workers by half when the queue is over the
+// targets, and shrink them to the busy ones once they have been idle for IdleAfter, always
+// within Min and Max. The number given to Start is the initial size. Only the tasks could be
+// dispatched now count, more workers won't start the ones deferred by the calendars or
+// waiting for resources in use.
+//
+// The autoscaler owns the size of the unlabeled workers, a size set by Resize, such as by
+// the admin endpoint, is kept only until the autoscaler decides otherwise.
+func WithAutoscaler(c AutoscaleConfig) Option {
+	return func(s *Scheduler) {
+		if c.Interval <= 0 {
+			c.Interval = defaultAutoscaleInterval
+		}
+		if c.Max < c.Min {
+			c.Max = c.Min
+		}
+
+		s.autoscale = &autoscaler{config: c}
+	}
+}
+
+// autoscaler is the state of the autoscaling of a scheduler
+type autoscaler struct {
+	config     AutoscaleConfig
+	lastResize time.Time
+	idleSince  time.Time
+}
+
+// decide returns the workers wanted and why, given the current ones, the busy ones and the
+// waiting tasks
+func (a *autoscaler) decide(now time.Time, workers, busy, depth int, wait time.Duration) (int, string) {
+	c := a.config
+	if workers < c.Min {
+		return c.Min, "min"
+	}
+	if workers > c.Max {
+		return c.Max, "max"
+	}
+
+	if depth > 0 || busy >= workers {
+		a.idleSince = time.Time{}
+	} else if a.idleSince.IsZero() {
+		a.idleSince = now
+	}
+
+	if now.Sub(a.lastResize) < c.Cooldown {
+		return workers, ""
+	}
+
+	if (c.TargetWait > 0 && wait > c.TargetWait) || (c.TargetDepth > 0 && depth > c.TargetDepth) {
+		step := workers / 2
+		if step < 1 {
+			step = 1
+		}
+		if workers+step > c.Max {
+			return c.Max, "overloaded"
+		}
+		return workers + step, "overloaded"
+	}
+
+	if c.IdleAfter > 0 && !a.idleSince.IsZero() && now.Sub(a.idleSince) >= c.IdleAfter {
+		if busy < c.Min {
+			return c.Min, "idle"
+		}
+		return busy, "idle"
+	}
+
+	return workers, ""
+}
+
+// scale resizes the workers if the autoscaler decides to
+func (s *Scheduler) scale() {
+	a := s.autoscale
+	now := s.clock.Now()
+	tasks := s.dispatchable(s.queue.Tasks())
+
+	s.runMu.Lock()
+	busy := len(s.running)
+	s.runMu.Unlock()
+
+	workers := s.Workers()
+	if busy > workers {
+		// the labeled workers are busy too
+		busy = workers
+	}
+
+	target, reason := a.decide(now, workers, busy, len(tasks), s.latency(tasks))
+	labels := map[string]string{"queue": s.name}
+	s.metrics.SetGauge("autoscale_workers", labels, float64(workers))
+	if target == workers {
+		return
+	}
+
+	direction := "up"
+	if target < workers {
+		direction = "down"
+	}
+
+	s.logger.Info("autoscale workers", "from", workers, "to", target, "reason", reason,
+		"waiting", len(tasks), "busy", busy)
+	s.metrics.AddCounter("autoscale_decisions_total", map[string]string{"queue": s.name, "direction": direction, "reason": reason}, 1)
+	s.metrics.SetGauge("autoscale_workers", labels, float64(target))
+
+	s.Resize(target)
+	a.lastResize = now
+	a.idleSince = time.Time{}
+}
+
+// watchScale runs the autoscaler until the scheduler stops
+func (s *Scheduler) watchScale() {
+	ticker := s.clock.NewTicker(s.autoscale.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.scale()
+		case <-s.shutdown:
+			return
+		}
+	}
+}
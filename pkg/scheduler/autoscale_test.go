@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoscalerDecide(t *testing.T) {
+	now := time.Now()
+	a := &autoscaler{config: AutoscaleConfig{
+		Min:         1,
+		Max:         5,
+		TargetWait:  time.Second,
+		TargetDepth: 10,
+		IdleAfter:   time.Minute,
+		Cooldown:    10 * time.Second,
+	}}
+
+	cases := []struct {
+		name       string
+		after      time.Duration
+		workers    int
+		busy       int
+		depth      int
+		wait       time.Duration
+		target     int
+		reason     string
+		lastResize bool
+	}{
+		{name: "below min", workers: 0, target: 1, reason: "min"},
+		{name: "above max", workers: 8, busy: 8, target: 5, reason: "max"},
+		{name: "long wait", workers: 2, busy: 2, depth: 1, wait: 2 * time.Second, target: 3, reason: "overloaded", lastResize: true},
+		{name: "cooldown", after: 5 * time.Second, workers: 3, busy: 3, depth: 20, target: 3},
+		{name: "deep queue", after: 11 * time.Second, workers: 4, busy: 4, depth: 20, target: 5, reason: "overloaded", lastResize: true},
+		{name: "idle starts", after: 30 * time.Second, workers: 5, busy: 1, target: 5},
+		{name: "idle", after: 91 * time.Second, workers: 5, busy: 1, target: 1, reason: "idle"},
+	}
+
+	for _, c := range cases {
+		at := now.Add(c.after)
+		target, reason := a.decide(at, c.workers, c.busy, c.depth, c.wait)
+		if target != c.target || reason != c.reason {
+			t.Errorf("%s: decision is expected as %d %q, actually %d %q", c.name, c.target, c.reason, target, reason)
+		}
+		if c.lastResize {
+			a.lastResize = at
+		}
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	metrics := NewMemoryMetrics()
+	watch, started := watchWorkers()
+	s := New(WithClock(clock), WithMetrics(metrics), watch, WithAutoscaler(AutoscaleConfig{
+		Min:         1,
+		Max:         3,
+		TargetDepth: 1,
+		Interval:    time.Second,
+	}))
+	go s.Start(1)
+	<-started
+
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+
+	// the ticker of the autoscaler
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-started
+	if n := s.Workers(); n != 2 {
+		t.Errorf("workers are expected as 2, actually %d", n)
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	labels := map[string]string{"queue": "default", "direction": "up", "reason": "overloaded"}
+	if n := metrics.Value("autoscale_decisions_total", labels); n != 1 {
+		t.Errorf("decisions are expected as 1, actually %v", n)
+	}
+}
+
+func TestAutoscaleSkipsDeferred(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC))
+	watch, started := watchWorkers()
+	s := New(WithClock(clock), watch, WithAutoscaler(AutoscaleConfig{
+		Min:         1,
+		Max:         3,
+		TargetWait:  time.Second,
+		TargetDepth: 1,
+	}))
+	go s.Start(1)
+	<-started
+
+	for i := 0; i < 3; i++ {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return nil
+		}).WithCalendar(Calendar{Allowed: []Window{{Start: "12:00", End: "13:00"}}}))
+	}
+
+	s.scale()
+	if n := s.Workers(); n != 1 {
+		t.Errorf("the tasks deferred by the calendars aren't expected to grow the workers, actually %d", n)
+	}
+	s.Stop()
+}
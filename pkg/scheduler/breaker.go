@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is the error of a task refused by an open circuit breaker
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every task through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen refuses every task
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of probes through
+	BreakerHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// BreakerConfig is the configuration of a circuit breaker
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures trips the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting probes through
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of tasks allowed to run at the same time when half-open
+	HalfOpenProbes int
+	// Hold keeps refused tasks until the breaker lets them through, instead of failing
+	// them with ErrBreakerOpen
+	Hold bool
+}
+
+// DefaultBreakerConfig is used by the breakers not configured by WithBreakerConfig
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenProbes:   1,
+}
+
+// WithBreakerConfig sets the configuration of the circuit breaker named name
+func WithBreakerConfig(name string, c BreakerConfig) Option {
+	return func(s *Scheduler) {
+		s.breakerConfigs[name] = c
+	}
+}
+
+// Breaker is a circuit breaker shared by the tasks declare the same name, usually the name
+// of a downstream dependency
+type Breaker struct {
+	name   string
+	config BreakerConfig
+	sche   *Scheduler
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	probes   int
+	held     []*task
+}
+
+// Breaker returns the circuit breaker named name, it's created on first use
+func (s *Scheduler) Breaker(name string) *Breaker {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+
+	b, ok := s.breakers[name]
+	if !ok {
+		config, ok := s.breakerConfigs[name]
+		if !ok {
+			config = DefaultBreakerConfig
+		}
+
+		b = &Breaker{
+			name:   name,
+			config: config,
+			sche:   s,
+		}
+		s.breakers[name] = b
+	}
+
+	return b
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// allowOrHold reports whether t may run now, the caller must call record with the result
+// if it's allowed. A refused task is held until the breaker lets tasks through again if the
+// breaker is configured to, the check and the hold are done at once so that the breaker
+// can't turn half-open in between and leave t held with no probe to release it.
+func (b *Breaker) allowOrHold(t *task) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.probes < b.config.HalfOpenProbes {
+			b.probes++
+			return true
+		}
+	}
+
+	b.sche.metrics.AddCounter("breaker_rejected_total", map[string]string{"breaker": b.name}, 1)
+	if b.config.Hold {
+		b.held = append(b.held, t)
+		b.sche.delay(1)
+	}
+
+	return false
+}
+
+// forget gives back the probe of a task allowed by the breaker without counting its result,
+// such as one cancelled while it was running. The held tasks are released to take the probe.
+func (b *Breaker) forget() {
+	b.mu.Lock()
+
+	var released []*task
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+		released, b.held = b.held, nil
+	}
+	b.mu.Unlock()
+
+	b.release(released)
+}
+
+// record counts the result of a task allowed by the breaker
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+
+	from := b.state
+	var released []*task
+	if err == nil {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.state = BreakerClosed
+			released, b.held = b.held, nil
+		}
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.config.FailureThreshold) {
+			b.trip()
+		}
+	}
+
+	to := b.state
+	b.mu.Unlock()
+
+	if from != to {
+		b.changed(to, err)
+	}
+	b.release(released)
+}
+
+// trip opens the breaker and lets probes through after the open timeout, the caller must
+// hold the lock
+func (b *Breaker) trip() {
+	b.state = BreakerOpen
+	b.probes = 0
+	b.sche.clock.AfterFunc(b.config.OpenTimeout, b.halfOpen)
+}
+
+// halfOpen lets probes through
+func (b *Breaker) halfOpen() {
+	b.mu.Lock()
+	if b.state != BreakerOpen {
+		b.mu.Unlock()
+		return
+	}
+
+	b.state = BreakerHalfOpen
+	released := b.held
+	b.held = nil
+	b.mu.Unlock()
+
+	b.changed(BreakerHalfOpen, nil)
+	b.release(released)
+}
+
+// release puts the held tasks back to the queue
+func (b *Breaker) release(tasks []*task) {
+	for _, t := range tasks {
+		if err := b.sche.enqueue(context.Background(), t); err != nil {
+			b.sche.logger.Error("release held task failed", "breaker", b.name, "error", err)
+			t.complete(Outcome{Err: err, Attempt: t.attempts, Reason: err})
+		}
+		b.sche.delay(-1)
+	}
+}
+
+// changed reports the new state of the breaker
+func (b *Breaker) changed(state BreakerState, err error) {
+	events := map[BreakerState]EventType{
+		BreakerClosed:   EventBreakerClosed,
+		BreakerOpen:     EventBreakerOpen,
+		BreakerHalfOpen: EventBreakerHalfOpen,
+	}
+
+	b.sche.logger.Info("circuit breaker state changed", "breaker", b.name, "state", state)
+	b.sche.metrics.SetGauge("breaker_state", map[string]string{"breaker": b.name}, float64(state))
+	b.sche.emit(Event{Type: events[state], Name: b.name, Err: err})
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []EventType
+}
+
+func (r *eventRecorder) OnEvent(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e.Type)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]EventType(nil), r.events...)
+}
+
+func TestBreakerFastFail(t *testing.T) {
+	counter := 0
+	var caught error
+	clock := NewFakeClock(time.Now())
+	metrics := NewMemoryMetrics()
+	recorder := &eventRecorder{}
+	s := New(
+		WithClock(clock),
+		WithMetrics(metrics),
+		WithObserver(recorder),
+		WithBreakerConfig("minio", BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Second, HalfOpenProbes: 1}),
+	)
+	go s.Start(1)
+
+	for i := 0; i < 2; i++ {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return errors.New("minio is down")
+		}).WithBreaker("minio"))
+	}
+	s.Wait()
+
+	if state := s.Breaker("minio").State(); state != BreakerOpen {
+		t.Fatalf("state is expected as %s, actually %s", BreakerOpen, state)
+	}
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		counter++
+		return nil
+	}).WithBreaker("minio").(RetryTask).WithRetry(3).(RetryTask).WithCatch(func(err error) {
+		caught = err
+	}))
+	s.Wait()
+
+	if counter != 0 || !errors.Is(caught, ErrBreakerOpen) {
+		t.Errorf("task is expected to fail fast, counter %d, error %v", counter, caught)
+	}
+
+	clock.Advance(time.Second)
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		counter++
+		return nil
+	}).WithBreaker("minio"))
+	s.Wait()
+	s.Stop()
+
+	if counter != 1 {
+		t.Errorf("counter is expected as %d, actually %d", 1, counter)
+	}
+
+	expected := []EventType{EventBreakerOpen, EventBreakerHalfOpen, EventBreakerClosed}
+	events := recorder.types()
+	if len(events) != len(expected) {
+		t.Fatalf("events are expected as %v, actually %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("events are expected as %v, actually %v", expected, events)
+		}
+	}
+
+	if v := metrics.Value("breaker_rejected_total", map[string]string{"breaker": "minio"}); v != 1 {
+		t.Errorf("rejected is expected as %d, actually %v", 1, v)
+	}
+}
+
+func TestBreakerHold(t *testing.T) {
+	counter := 0
+	clock := NewFakeClock(time.Now())
+	s := New(
+		WithClock(clock),
+		WithBreakerConfig("api", BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenProbes: 1, Hold: true}),
+	)
+	go s.Start(1)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return errors.New("api is down")
+	}).WithBreaker("api"))
+	s.Wait()
+
+	for i := 0; i < 3; i++ {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			counter++
+			return nil
+		}).WithBreaker("api"))
+	}
+
+	// the open timeout timer
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	s.Wait()
+	s.Stop()
+
+	if counter != 3 {
+		t.Errorf("counter is expected as %d, actually %d", 3, counter)
+	}
+
+	if state := s.Breaker("api").State(); state != BreakerClosed {
+		t.Errorf("state is expected as %s, actually %s", BreakerClosed, state)
+	}
+}
+
+func TestBreakerIgnoresCancelled(t *testing.T) {
+	s := New(WithBreakerConfig("api", BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenProbes: 1}))
+	go s.Start(1)
+
+	started := make(chan struct{})
+	task, cancel := TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithBreaker("api").(RetryTask).WithCancelFunc(0)
+	s.Schedule(task.(IdentifiedTask).WithID("cancelled"))
+	<-started
+	cancel()
+	s.Wait()
+
+	if state := s.Breaker("api").State(); state != BreakerClosed {
+		t.Fatalf("a cancelled task isn't expected to open the breaker, actually %s", state)
+	}
+
+	started = make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithBreaker("api").(IdentifiedTask).WithID("cancelled-by-id"))
+	<-started
+	if err := s.Cancel("cancelled-by-id"); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	s.Stop()
+
+	if state := s.Breaker("api").State(); state != BreakerClosed {
+		t.Errorf("cancelled tasks aren't expected to open the breaker, actually %s", state)
+	}
+}
@@ -0,0 +1,327 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCalendar is returned when a window of a calendar can't be parsed
+var ErrInvalidCalendar = errors.New("invalid calendar")
+
+// calendarHorizon is how far ahead a calendar is searched for the next eligible time, the
+// windows repeat every week
+const calendarHorizon = 8 * 24 * time.Hour
+
+// Window is a period repeated on the days given, such as "09:00" to "17:00" from Monday to
+// Friday. An End not after Start means the window ends on the next day.
+type Window struct {
+	// Days are the days the window starts on, empty means every day
+	Days  []time.Weekday `json:"days,omitempty"`
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+	// Location is the name of the time zone, such as "Asia/Shanghai", empty means UTC
+	Location string `json:"location,omitempty"`
+}
+
+// Validate checks the times and the time zone of the window
+func (w Window) Validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+
+	_, err := loadLocation(w.Location)
+	return err
+}
+
+// spans returns the periods of the window start from the day before from until the days
+// after, the window must be valid
+func (w Window) spans(from time.Time, days int) [][2]time.Time {
+	loc, _ := loadLocation(w.Location)
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	if end <= start {
+		end += 24 * time.Hour
+	}
+
+	from = from.In(loc)
+	var spans [][2]time.Time
+	for i := -1; i <= days; i++ {
+		day := time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, loc)
+		if len(w.Days) > 0 && !hasWeekday(w.Days, day.Weekday()) {
+			continue
+		}
+
+		spans = append(spans, [2]time.Time{at(day, start), at(day, end)})
+	}
+
+	return spans
+}
+
+// contains reports whether t is in the window
+func (w Window) contains(t time.Time) bool {
+	for _, span := range w.spans(t, 0) {
+		if !t.Before(span[0]) && t.Before(span[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Calendar decides when tasks may be dispatched, a task may run inside any of the Allowed
+// windows but none of the Blackout windows. No Allowed window means any time.
+type Calendar struct {
+	Allowed  []Window `json:"allowed,omitempty"`
+	Blackout []Window `json:"blackout,omitempty"`
+}
+
+// IsZero reports whether c allows any time
+func (c Calendar) IsZero() bool {
+	return len(c.Allowed) == 0 && len(c.Blackout) == 0
+}
+
+// Validate checks all the windows of c
+func (c Calendar) Validate() error {
+	for _, w := range append(append([]Window{}, c.Allowed...), c.Blackout...) {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Allows reports whether c allows t
+func (c Calendar) Allows(t time.Time) bool {
+	for _, w := range c.Blackout {
+		if w.contains(t) {
+			return false
+		}
+	}
+
+	if len(c.Allowed) == 0 {
+		return true
+	}
+
+	for _, w := range c.Allowed {
+		if w.contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Next returns the first time not before t allowed by c, it returns false if there isn't one
+// in a week
+func (c Calendar) Next(t time.Time) (time.Time, bool) {
+	return nextEligible(t, c)
+}
+
+// nextEligible returns the first time not before t allowed by all the calendars. It's either
+// t or a time a window starts or ends, since nothing changes between them.
+func nextEligible(t time.Time, calendars ...Calendar) (time.Time, bool) {
+	candidates := []time.Time{t}
+	for _, c := range calendars {
+		for _, w := range append(append([]Window{}, c.Allowed...), c.Blackout...) {
+			for _, span := range w.spans(t, int(calendarHorizon/(24*time.Hour))) {
+				candidates = append(candidates, span[0], span[1])
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	for _, candidate := range candidates {
+		if candidate.Before(t) || candidate.After(t.Add(calendarHorizon)) {
+			continue
+		}
+
+		if allowed(candidate, calendars...) {
+			return candidate, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// allowed reports whether all the calendars allow t
+func allowed(t time.Time, calendars ...Calendar) bool {
+	for _, c := range calendars {
+		if !c.Allows(t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithCalendar sets the calendar of the scheduler, it applies to all the tasks along with
+// their own calendars
+func WithCalendar(c Calendar) Option {
+	return func(s *Scheduler) {
+		s.calendar = c
+	}
+}
+
+// DeferredTask is a waiting task its calendar doesn't allow to run now
+type DeferredTask struct {
+	ID string
+	// EligibleAt is when the task may run next, it's zero if the calendar never allows it
+	EligibleAt time.Time
+}
+
+// Deferred returns the waiting tasks deferred by the calendars, ordered by the time they
+// become eligible
+func (s *Scheduler) Deferred() []DeferredTask {
+	now := s.clock.Now()
+
+	s.taskMu.Lock()
+	var waiting []*task
+	for _, t := range s.tasks {
+		waiting = append(waiting, t)
+	}
+	s.taskMu.Unlock()
+
+	var deferred []DeferredTask
+	for _, t := range waiting {
+		if s.isRunning(t) || allowed(now, s.calendar, t.calendar) {
+			continue
+		}
+
+		next, _ := nextEligible(now, s.calendar, t.calendar)
+		deferred = append(deferred, DeferredTask{ID: t.id, EligibleAt: next})
+	}
+
+	sort.Slice(deferred, func(i, j int) bool {
+		return deferred[i].EligibleAt.Before(deferred[j].EligibleAt)
+	})
+
+	return deferred
+}
+
+// eligible reports whether the calendars allow t to run now, otherwise the dispatch is
+// woken up when it becomes eligible
+func (s *Scheduler) eligible(t *task) bool {
+	if s.calendar.IsZero() && t.calendar.IsZero() {
+		return true
+	}
+
+	now := s.clock.Now()
+	if allowed(now, s.calendar, t.calendar) {
+		return true
+	}
+
+	if next, ok := nextEligible(now, s.calendar, t.calendar); ok {
+		s.wakeAt(next)
+	}
+
+	return false
+}
+
+// wakeAt wakes the dispatch up at t, only the earliest time is kept
+func (s *Scheduler) wakeAt(t time.Time) {
+	s.wakeMu.Lock()
+	defer s.wakeMu.Unlock()
+
+	if s.wakeTimer != nil && !t.Before(s.wakeTime) {
+		return
+	}
+
+	if s.wakeTimer != nil {
+		s.wakeTimer.Stop()
+	}
+
+	s.wakeTime = t
+	s.wakeTimer = s.clock.AfterFunc(t.Sub(s.clock.Now()), func() {
+		s.wakeMu.Lock()
+		s.wakeTimer = nil
+		s.wakeMu.Unlock()
+
+		s.wake()
+	})
+}
+
+// wake lets the dispatcher or the parked workers have a look at the queue again
+func (s *Scheduler) wake() {
+	if q, ok := s.queue.(*stealingQueue); ok {
+		q.wakeAll()
+		return
+	}
+
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// isRunning reports whether t is running
+func (s *Scheduler) isRunning(t *task) bool {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	_, ok := s.running[t]
+	return ok
+}
+
+// parseClock parses a time of the day such as "09:30"
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: %w", s, err)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// at returns the time d after the midnight of day, it's counted by the clock so it's right
+// on the days the daylight saving time changes
+func at(day time.Time, d time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(d/time.Minute), 0, 0, day.Location())
+}
+
+// hasWeekday reports whether days has d
+func hasWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, day := range days {
+		if day == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	locationMu sync.Mutex
+	locations  = map[string]*time.Location{}
+)
+
+// loadLocation loads the time zone named name once, empty means UTC
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	locationMu.Lock()
+	defer locationMu.Unlock()
+
+	if loc, ok := locations[name]; ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations[name] = loc
+	return loc, nil
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	business := Window{
+		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start:    "09:00",
+		End:      "17:00",
+		Location: "Asia/Shanghai",
+	}
+	calendar := Calendar{
+		Allowed:  []Window{business},
+		Blackout: []Window{{Days: []time.Weekday{time.Friday}, Start: "12:00", End: "13:00", Location: "Asia/Shanghai"}},
+	}
+
+	cases := []struct {
+		now     time.Time
+		allowed bool
+		next    time.Time
+	}{
+		// Monday
+		{time.Date(2021, 6, 7, 10, 0, 0, 0, shanghai), true, time.Date(2021, 6, 7, 10, 0, 0, 0, shanghai)},
+		{time.Date(2021, 6, 7, 8, 0, 0, 0, shanghai), false, time.Date(2021, 6, 7, 9, 0, 0, 0, shanghai)},
+		{time.Date(2021, 6, 7, 18, 0, 0, 0, shanghai), false, time.Date(2021, 6, 8, 9, 0, 0, 0, shanghai)},
+		// Friday during the blackout
+		{time.Date(2021, 6, 11, 12, 30, 0, 0, shanghai), false, time.Date(2021, 6, 11, 13, 0, 0, 0, shanghai)},
+		// Saturday in UTC is still Friday in Shanghai
+		{time.Date(2021, 6, 11, 16, 0, 0, 0, time.UTC), false, time.Date(2021, 6, 14, 9, 0, 0, 0, shanghai)},
+	}
+
+	for _, c := range cases {
+		if allowed := calendar.Allows(c.now); allowed != c.allowed {
+			t.Errorf("%v is expected to be allowed %v, actually %v", c.now, c.allowed, allowed)
+		}
+
+		if next, ok := calendar.Next(c.now); !ok || !next.Equal(c.next) {
+			t.Errorf("next of %v is expected as %v, actually %v", c.now, c.next, next)
+		}
+	}
+
+	if err := (Window{Start: "25:00", End: "26:00"}).Validate(); err == nil {
+		t.Error("invalid window is expected to fail the validation")
+	}
+}
+
+func TestCalendarDispatch(t *testing.T) {
+	// Sunday 02:00
+	clock := NewFakeClock(time.Date(2021, 6, 6, 2, 0, 0, 0, time.UTC))
+	maintenance := Window{Days: []time.Weekday{time.Sunday}, Start: "00:00", End: "04:00"}
+	s := New(WithClock(clock), WithCalendar(Calendar{Blackout: []Window{maintenance}}))
+	go s.Start(1)
+
+	done := make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(done)
+		return nil
+	}).WithID("backup"))
+
+	// the wake up timer
+	clock.BlockUntil(1)
+	deferred := s.Deferred()
+	if len(deferred) != 1 || deferred[0].ID != "backup" || !deferred[0].EligibleAt.Equal(clock.Now().Add(2*time.Hour)) {
+		t.Errorf("deferred is unexpected: %+v", deferred)
+	}
+
+	select {
+	case <-done:
+		t.Fatal("task isn't expected to run during the blackout")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(2 * time.Hour)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("task is expected to run when the blackout ends")
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestCalendarNever(t *testing.T) {
+	always := Window{Start: "00:00", End: "00:00"}
+	s := New(WithCalendar(Calendar{Blackout: []Window{always}}))
+
+	err := s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	if !errors.Is(err, ErrUnschedulable) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnschedulable, err)
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrTaskNotFound is returned when no scheduled task has the id
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrDuplicateTask is returned when a task is scheduled with the id of another one isn't
+	// completed yet
+	ErrDuplicateTask = errors.New("task id already in use")
+)
+
+// Cancel stops the task with id and its children. A waiting task is taken out of the queue,
+// the context of a running task is cancelled, either way its outcome has ErrCancelled as the
+// reason.
+func (s *Scheduler) Cancel(id string) error {
+	s.taskMu.Lock()
+	t, ok := s.tasks[id]
+	s.taskMu.Unlock()
+
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	t.cancel()
+	s.logger.Info("task cancelled", "task", id)
+	s.cancelChildren(t)
+
+	if s.queue.Remove(t) {
+		t.complete(Outcome{Err: ErrCancelled, Attempt: t.attempts, Reason: ErrCancelled})
+	}
+
+	return nil
+}
+
+// track makes t cancellable by its id until it's completed, it returns ErrDuplicateTask if
+// another task has the id
+func (s *Scheduler) track(t Task) error {
+	realTask, ok := t.(*task)
+	if !ok {
+		return nil
+	}
+
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	if tracked, ok := s.tasks[realTask.id]; ok {
+		if tracked == realTask {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, realTask.id)
+	}
+
+	realTask.parent = realTask.ctx
+	realTask.ctx, realTask.cancel = context.WithCancel(realTask.ctx)
+	s.tasks[realTask.id] = realTask
+
+	// a task scheduled again may spawn children again
+	realTask.childMu.Lock()
+	realTask.childCancelled = false
+	realTask.childMu.Unlock()
+
+	return nil
+}
+
+// TaskIDFromContext returns the id of the task running with ctx, the one it's cancelled by
+func TaskIDFromContext(ctx context.Context) (string, bool) {
+	e, ok := ctx.Value(reporterKey{}).(*execution)
+	if !ok {
+		return "", false
+	}
+
+	return e.task.id, true
+}
+
+// untrack forgets t, its context is restored so that it can be scheduled again
+func (s *Scheduler) untrack(t *task) {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	if s.tasks[t.id] == t {
+		delete(s.tasks, t.id)
+		t.cancel()
+		t.ctx = t.parent
+
+		if t.missTimer != nil {
+			t.missTimer.Stop()
+			t.missTimer = nil
+		}
+		if t.expireTimer != nil {
+			t.expireTimer.Stop()
+			t.expireTimer = nil
+		}
+		atomic.StoreInt32(&t.missed, 0)
+	}
+}
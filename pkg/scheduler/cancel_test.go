@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCancelByID(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"dispatcher":    nil,
+		"work stealing": {WithWorkStealing(2)},
+	} {
+		s := New(opts...)
+		go s.Start(1)
+
+		outcomes := make(chan Outcome, 2)
+		started := make(chan struct{})
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}).WithID("running").(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			outcomes <- o
+		}))
+		<-started
+
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			t.Errorf("%s: cancelled task isn't expected to run", name)
+			return nil
+		}).WithID("queued").(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			outcomes <- o
+		}))
+
+		if err := s.Cancel("queued"); err != nil {
+			t.Fatal(err)
+		}
+		if o := <-outcomes; o.TaskID != "queued" || o.Reason != ErrCancelled || o.Attempt != 0 {
+			t.Errorf("%s: outcome of the queued task is unexpected: %+v", name, o)
+		}
+
+		if err := s.Cancel("running"); err != nil {
+			t.Fatal(err)
+		}
+		if o := <-outcomes; o.TaskID != "running" || o.Reason != ErrCancelled || o.Attempt != 1 {
+			t.Errorf("%s: outcome of the running task is unexpected: %+v", name, o)
+		}
+
+		s.Wait()
+		s.Stop()
+
+		if err := s.Cancel("running"); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("%s: error is expected as %v, actually %v", name, ErrTaskNotFound, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotInTask is returned when a checkpoint is saved with a context doesn't belong to a
+// running task
+var ErrNotInTask = errors.New("checkpoint outside a running task")
+
+// Checkpoint is the last data saved by a task, Attempt is the number of the attempt saved it
+type Checkpoint struct {
+	Attempt uint
+	Data    []byte
+}
+
+// CheckpointStore keeps the last checkpoint of the tasks by their ids
+type CheckpointStore interface {
+	Save(ctx context.Context, id string, c Checkpoint) error
+	// Load returns nil without an error if the task has no checkpoint
+	Load(ctx context.Context, id string) (*Checkpoint, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// WithCheckpointStore sets where the checkpoints are kept, they're kept in memory by
+// default, so that they only survive the retries. The ids generated by the scheduler start
+// over when it restarts, so the checkpoints of the tasks without an id given by the caller
+// are always kept in memory.
+func WithCheckpointStore(store CheckpointStore) Option {
+	return func(s *Scheduler) {
+		s.checkpoints = store
+	}
+}
+
+// SaveCheckpoint saves data as the checkpoint of the task running with ctx, a retried task
+// gets it by LoadCheckpoint. It's deleted once the task has its outcome, so only a task
+// scheduled by Recover after the scheduler stopped before that, such as by a crash, resumes
+// from it. It also counts as a heartbeat.
+func SaveCheckpoint(ctx context.Context, data []byte) error {
+	e, ok := ctx.Value(reporterKey{}).(*execution)
+	if !ok {
+		return ErrNotInTask
+	}
+
+	c := Checkpoint{Attempt: e.attempt, Data: data}
+	if err := e.sche.checkpointsOf(e.task).Save(ctx, e.task.id, c); err != nil {
+		return err
+	}
+
+	e.Heartbeat()
+	return nil
+}
+
+// LoadCheckpoint returns the last checkpoint of the task running with ctx, nil if it has
+// none, which means it starts from scratch
+func LoadCheckpoint(ctx context.Context) ([]byte, error) {
+	e, ok := ctx.Value(reporterKey{}).(*execution)
+	if !ok {
+		return nil, ErrNotInTask
+	}
+
+	c, err := e.sche.checkpointsOf(e.task).Load(ctx, e.task.id)
+	if err != nil || c == nil {
+		return nil, err
+	}
+
+	return c.Data, nil
+}
+
+// Recover schedules t again after the scheduler stopped while it was running, such as by a
+// crash, t must have the id it had then. It resumes from its checkpoint, and the attempts
+// before count against its retries.
+func (s *Scheduler) Recover(t Task) error {
+	if realTask, ok := t.(*task); ok && realTask.id != "" {
+		c, err := s.checkpoints.Load(context.Background(), realTask.id)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			realTask.attempts = c.Attempt
+		}
+	}
+
+	return s.Schedule(t)
+}
+
+// checkpointsOf returns the store keeps the checkpoints of t
+func (s *Scheduler) checkpointsOf(t *task) CheckpointStore {
+	if t.generated {
+		return s.volatile
+	}
+
+	return s.checkpoints
+}
+
+// dropCheckpoint deletes the checkpoint of a task has its final outcome, whether it succeeded
+// or not, it won't be resumed any more. The context of the task may be cancelled already, so
+// it isn't used.
+func (s *Scheduler) dropCheckpoint(t *task) {
+	if err := s.checkpointsOf(t).Delete(context.Background(), t.id); err != nil {
+		s.logger.Warn("delete checkpoint failed", "task", t.id, "error", err)
+	}
+}
+
+// memoryCheckpointStore is a CheckpointStore in memory
+type memoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointStore returns a CheckpointStore keeps the checkpoints in memory
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{
+		checkpoints: map[string]Checkpoint{},
+	}
+}
+
+// Save is the CheckpointStore interface implementation
+func (m *memoryCheckpointStore) Save(ctx context.Context, id string, c Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.Data = append([]byte(nil), c.Data...)
+	m.checkpoints[id] = c
+	return nil
+}
+
+// Load is the CheckpointStore interface implementation
+func (m *memoryCheckpointStore) Load(ctx context.Context, id string) (*Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.checkpoints[id]
+	if !ok {
+		return nil, nil
+	}
+
+	c.Data = append([]byte(nil), c.Data...)
+	return &c, nil
+}
+
+// Delete is the CheckpointStore interface implementation
+func (m *memoryCheckpointStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.checkpoints, id)
+	return nil
+}
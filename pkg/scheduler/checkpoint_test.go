@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	s := New(WithCheckpointStore(store))
+	go s.Start(1)
+
+	var loaded []string
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		data, err := LoadCheckpoint(ctx)
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, string(data))
+
+		if data == nil {
+			if err := SaveCheckpoint(ctx, []byte("step-1")); err != nil {
+				t.Error(err)
+			}
+			return errors.New("failed after step 1")
+		}
+
+		return nil
+	}).WithRetry(1).(IdentifiedTask).WithID("resumable"))
+	s.Wait()
+	s.Stop()
+
+	if len(loaded) != 2 || loaded[0] != "" || loaded[1] != "step-1" {
+		t.Errorf("the retry is expected to resume from the checkpoint, actually %q", loaded)
+	}
+
+	if c, err := store.Load(context.Background(), "resumable"); err != nil || c != nil {
+		t.Errorf("checkpoint is expected to be deleted after the task succeeds, actually %+v %v", c, err)
+	}
+
+	if err := SaveCheckpoint(context.Background(), nil); err != ErrNotInTask {
+		t.Errorf("error is expected as %v, actually %v", ErrNotInTask, err)
+	}
+}
+
+func TestCheckpointDroppedOnFailure(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	s := New(WithCheckpointStore(store))
+	go s.Start(1)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		if err := SaveCheckpoint(ctx, []byte("step-1")); err != nil {
+			t.Error(err)
+		}
+		return errors.New("failed after step 1")
+	}).WithRetry(1).(IdentifiedTask).WithID("failed"))
+	s.Wait()
+	s.Stop()
+
+	if c, err := store.Load(context.Background(), "failed"); err != nil || c != nil {
+		t.Errorf("checkpoint is expected to be deleted after the task fails for good, actually %+v %v", c, err)
+	}
+}
+
+func TestCheckpointRecover(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+
+	// the first scheduler crashes while the task is running after its checkpoint
+	crashed := New(WithCheckpointStore(store))
+	go crashed.Start(1)
+
+	saved := make(chan struct{})
+	crashed.Schedule(TaskFunc(func(ctx context.Context) error {
+		if err := SaveCheckpoint(ctx, []byte("step-1")); err != nil {
+			t.Error(err)
+		}
+		close(saved)
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithRetry(1).(IdentifiedTask).WithID("42"))
+	<-saved
+
+	if c, err := store.Load(context.Background(), "42"); err != nil || c == nil || c.Attempt != 1 || string(c.Data) != "step-1" {
+		t.Fatalf("checkpoint is expected as attempt 1 at step-1, actually %+v %v", c, err)
+	}
+
+	// the restarted scheduler recovers the task with the same id
+	s := New(WithCheckpointStore(store))
+	go s.Start(1)
+
+	var loaded []byte
+	outcomes := make(chan Outcome, 1)
+	err := s.Recover(TaskFunc(func(ctx context.Context) error {
+		data, err := LoadCheckpoint(ctx)
+		loaded = data
+		return err
+	}).WithRetry(1).(IdentifiedTask).WithID("42").(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o := <-outcomes; o.Err != nil || o.Attempt != 2 {
+		t.Errorf("outcome is expected as attempt 2 without an error, actually %+v", o)
+	}
+	if string(loaded) != "step-1" {
+		t.Errorf("checkpoint is expected as step-1, actually %q", loaded)
+	}
+	if c, err := store.Load(context.Background(), "42"); err != nil || c != nil {
+		t.Errorf("checkpoint is expected to be deleted after the task succeeds, actually %+v %v", c, err)
+	}
+
+	s.Wait()
+	s.Stop()
+	crashed.Cancel("42")
+	crashed.Stop()
+}
+
+func TestCheckpointGeneratedID(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	s := New(WithCheckpointStore(store))
+	go s.Start(1)
+
+	saved := make(chan string)
+	release := make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		if err := SaveCheckpoint(ctx, []byte("step-1")); err != nil {
+			t.Error(err)
+		}
+		id, _ := TaskIDFromContext(ctx)
+		saved <- id
+		<-release
+		return nil
+	}))
+	id := <-saved
+
+	// the id is given again after a restart, so it's kept out of the store
+	if c, err := store.Load(context.Background(), id); err != nil || c != nil {
+		t.Errorf("checkpoint of %s is expected to be kept in memory, actually %+v %v", id, c, err)
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoParent is returned when a child task is spawned with a context doesn't belong to a
+// running task
+var ErrNoParent = errors.New("context doesn't belong to a running task")
+
+// FromContext returns the scheduler runs the task with ctx, so that the task can spawn
+// children
+func FromContext(ctx context.Context) (*Scheduler, bool) {
+	e, ok := ctx.Value(reporterKey{}).(*execution)
+	if !ok {
+		return nil, false
+	}
+
+	return e.sche, true
+}
+
+// Spawn schedules t as a child of the task running with ctx. Cancelling the parent cancels
+// its children, but they go on after the parent finishes unless it waits for them by
+// WaitChildren.
+func (s *Scheduler) Spawn(ctx context.Context, t Task) error {
+	e, ok := ctx.Value(reporterKey{}).(*execution)
+	if !ok || e.sche != s {
+		return ErrNoParent
+	}
+
+	return s.spawn(e.task, t)
+}
+
+// ScheduleChild schedules t as a child of the scheduled task with parentID, it returns
+// ErrTaskNotFound if there isn't one
+func (s *Scheduler) ScheduleChild(parentID string, t Task) error {
+	s.taskMu.Lock()
+	parent, ok := s.tasks[parentID]
+	s.taskMu.Unlock()
+
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	return s.spawn(parent, t)
+}
+
+// WaitChildren waits until the children of the task running with ctx are completed, it
+// returns the first error of them. The parent keeps its worker while it waits, so if all the
+// workers the children could run on are taken by parents waiting this way, none of them
+// ever finishes. Leave enough workers to the children, or bound the wait by the deadline of
+// ctx.
+func WaitChildren(ctx context.Context) error {
+	e, ok := ctx.Value(reporterKey{}).(*execution)
+	if !ok {
+		return ErrNoParent
+	}
+
+	t := e.task
+	t.childMu.Lock()
+	if len(t.children) == 0 {
+		defer t.childMu.Unlock()
+		return t.childErr
+	}
+	idle := t.childIdle
+	t.childMu.Unlock()
+
+	select {
+	case <-idle:
+		t.childMu.Lock()
+		defer t.childMu.Unlock()
+		return t.childErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// spawn schedules t as a child of parent
+func (s *Scheduler) spawn(parent *task, t Task) error {
+	if s.isShutdown() {
+		return errSchedulerStop
+	}
+
+	s.taskMu.Lock()
+	tracked := s.tasks[parent.id] == parent
+	// the children share the context the parent is scheduled with, not the one cancelled
+	// once the parent is completed
+	ctx := parent.parent
+	s.taskMu.Unlock()
+
+	if !tracked {
+		return ErrTaskNotFound
+	}
+
+	t = t.BindScheduler(s)
+	child, ok := t.(*task)
+	if !ok {
+		return s.Schedule(t)
+	}
+
+	if child.ctx == nil {
+		child.SetContext(ctx)
+	}
+	child.parentTask = parent
+
+	if err := s.admit(child); err != nil {
+		return err
+	}
+
+	if !parent.addChild(child) {
+		return ErrCancelled
+	}
+	if err := s.submit(context.Background(), child); err != nil {
+		parent.childDone(child, Outcome{})
+		return err
+	}
+
+	// the parent may be cancelled before the child is tracked, then it can't find the child
+	// by its id
+	if parent.childrenCancelled() {
+		if err := s.Cancel(child.id); err != nil && !errors.Is(err, ErrTaskNotFound) {
+			s.logger.Warn("cancel child task failed", "task", child.id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// cancelChildren cancels the children of t not completed yet, no child can be added to t
+// after that
+func (s *Scheduler) cancelChildren(t *task) {
+	t.childMu.Lock()
+	t.childCancelled = true
+	children := make([]*task, len(t.children))
+	copy(children, t.children)
+	t.childMu.Unlock()
+
+	for _, child := range children {
+		if err := s.Cancel(child.id); err != nil && !errors.Is(err, ErrTaskNotFound) {
+			s.logger.Warn("cancel child task failed", "task", child.id, "error", err)
+		}
+	}
+}
+
+// parentID returns the id of the parent of t, empty if it isn't a child
+func (t *task) parentID() string {
+	if t.parentTask == nil {
+		return ""
+	}
+
+	return t.parentTask.id
+}
+
+// addChild counts child as running until it's completed, it returns false if the children of
+// t are cancelled already
+func (t *task) addChild(child *task) bool {
+	t.childMu.Lock()
+	defer t.childMu.Unlock()
+
+	if t.childCancelled {
+		return false
+	}
+
+	if len(t.children) == 0 {
+		t.childIdle = make(chan struct{})
+	}
+	t.children = append(t.children, child)
+	return true
+}
+
+// childrenCancelled reports whether the children of t are cancelled
+func (t *task) childrenCancelled() bool {
+	t.childMu.Lock()
+	defer t.childMu.Unlock()
+
+	return t.childCancelled
+}
+
+// childDone forgets child with its outcome, the waiters are released once no child is left
+func (t *task) childDone(child *task, o Outcome) {
+	t.childMu.Lock()
+	defer t.childMu.Unlock()
+
+	for i, c := range t.children {
+		if c != child {
+			continue
+		}
+
+		t.children = append(t.children[:i], t.children[i+1:]...)
+		if o.Err != nil && t.childErr == nil {
+			t.childErr = o.Err
+		}
+		if len(t.children) == 0 {
+			close(t.childIdle)
+		}
+		return
+	}
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSpawn(t *testing.T) {
+	s := New()
+	go s.Start(2)
+
+	var done int32
+	errChild := errors.New("child failed")
+	result := make(chan error, 1)
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		sche, ok := FromContext(ctx)
+		if !ok {
+			t.Error("scheduler is expected in the task context")
+			return nil
+		}
+
+		for i := 0; i < 3; i++ {
+			i := i
+			err := sche.Spawn(ctx, TaskFunc(func(ctx context.Context) error {
+				atomic.AddInt32(&done, 1)
+				if i == 1 {
+					return errChild
+				}
+				return nil
+			}))
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		result <- WaitChildren(ctx)
+		return nil
+	}))
+
+	if err := <-result; err != errChild {
+		t.Errorf("error is expected as %v, actually %v", errChild, err)
+	}
+	if n := atomic.LoadInt32(&done); n != 3 {
+		t.Errorf("children are expected to be done before the wait returns, actually %d", n)
+	}
+
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("scheduler isn't expected without a task")
+	}
+	if err := s.Spawn(context.Background(), TaskFunc(func(ctx context.Context) error {
+		return nil
+	})); err != ErrNoParent {
+		t.Errorf("error is expected as %v, actually %v", ErrNoParent, err)
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestCancelChildren(t *testing.T) {
+	s := New()
+	go s.Start(2)
+
+	spawned := make(chan struct{})
+	outcomes := make(chan Outcome, 2)
+	onOutcome := func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		// the running child takes the other worker, so the second one waits
+		started := make(chan struct{})
+		s.Spawn(ctx, TaskFunc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}).WithID("running").(OutcomeTask).OnOutcome(onOutcome))
+		<-started
+
+		s.Spawn(ctx, TaskFunc(func(ctx context.Context) error {
+			return nil
+		}).WithID("queued").(OutcomeTask).OnOutcome(onOutcome))
+		close(spawned)
+
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithID("parent"))
+	<-spawned
+
+	snapshot := s.Snapshot()
+	if len(snapshot.Queued) != 1 || snapshot.Queued[0].ParentID != "parent" {
+		t.Errorf("queued child is unexpected: %+v", snapshot.Queued)
+	}
+	for _, running := range snapshot.Running {
+		if running.ID == "running" && running.ParentID != "parent" {
+			t.Errorf("parent of the running child is unexpected: %+v", running)
+		}
+	}
+
+	if err := s.Cancel("parent"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if o := <-outcomes; o.Reason != ErrCancelled {
+			t.Errorf("child %s is expected to be cancelled, actually %+v", o.TaskID, o)
+		}
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestSpawnAfterCancel(t *testing.T) {
+	s := New()
+	go s.Start(1)
+
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	errs := make(chan error, 1)
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-cancelled
+		errs <- s.Spawn(ctx, TaskFunc(func(ctx context.Context) error {
+			t.Error("the child of a cancelled parent isn't expected to run")
+			return nil
+		}))
+		return ctx.Err()
+	}).WithID("parent"))
+
+	<-started
+	if err := s.Cancel("parent"); err != nil {
+		t.Fatal(err)
+	}
+	close(cancelled)
+
+	if err := <-errs; err != ErrCancelled {
+		t.Errorf("spawning from a cancelled parent is expected to fail with %v, actually %v", ErrCancelled, err)
+	}
+
+	s.Wait()
+	s.Stop()
+}
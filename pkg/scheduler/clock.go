@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for the scheduler, replace it with a FakeClock in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a pending call created by Clock.AfterFunc
+type Timer interface {
+	Stop() bool
+}
+
+// Ticker delivers ticks at intervals
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock is the Clock reads the system time
+type realClock struct{}
+
+// RealClock returns the Clock backed by package time
+func RealClock() Clock {
+	return realClock{}
+}
+
+// Now returns the current local time
+func (realClock) Now() time.Time { return time.Now() }
+
+// After waits for the duration to elapse and then sends the current time on the returned channel
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// AfterFunc waits for the duration to elapse and then calls f in its own goroutine
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// NewTicker returns a new Ticker ticks every d
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+// realTicker adapts time.Ticker to Ticker
+type realTicker struct {
+	*time.Ticker
+}
+
+// C returns the channel on which the ticks are delivered
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock is a Clock only moves when told to, so time based behaviors can be tested
+// without sleeping
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock returns a FakeClock starts at now
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// Now returns the fake current time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After sends the fake time on the returned channel once the clock has advanced by d
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.AfterFunc(d, func() {
+		ch <- c.Now()
+	})
+
+	return ch
+}
+
+// AfterFunc calls f once the clock has advanced by d, f runs in the goroutine calls Advance
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+
+	return t
+}
+
+// NewTicker returns a Ticker ticks every time the clock has advanced by d
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	t := &fakeTicker{ch: make(chan time.Time, 1)}
+
+	var tick func()
+	tick = func() {
+		select {
+		case t.ch <- c.Now():
+		default:
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.stopped {
+			t.timer = c.AfterFunc(d, tick)
+		}
+	}
+
+	// the first tick may fire before the assignment returns, so it's made under the lock too
+	t.mu.Lock()
+	t.timer = c.AfterFunc(d, tick)
+	t.mu.Unlock()
+
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers are due in order
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+
+	var due, pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].when.Before(due[j].when)
+	})
+
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// BlockUntil waits until at least n timers are waiting for the clock, it is used to make
+// sure a goroutine has started waiting before advancing the clock
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// remove cancels the timer t, returns false if it has fired or been stopped
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// fakeTimer is the Timer created by FakeClock
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+}
+
+// Stop prevents the timer from firing
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t)
+}
+
+// fakeTicker is the Ticker created by FakeClock
+type fakeTicker struct {
+	mu      sync.Mutex
+	ch      chan time.Time
+	timer   Timer
+	stopped bool
+}
+
+// C returns the channel on which the ticks are delivered
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+// Stop turns off the ticker
+func (t *fakeTicker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopped = true
+	t.timer.Stop()
+}
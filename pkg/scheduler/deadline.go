@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDeadlineUnmeetable is returned when a task can't finish before its deadline given the
+// tasks ahead of it and the recent run times
+var ErrDeadlineUnmeetable = errors.New("task deadline can't be met")
+
+// MissPolicy decides what happens to a task misses its deadline while waiting in the queue
+type MissPolicy int
+
+const (
+	// MissDrop takes the task out of the queue, its outcome has context.DeadlineExceeded as
+	// the reason
+	MissDrop MissPolicy = iota
+	// MissNotify calls the deadline-miss callbacks of the task and runs it late, without a
+	// timeout
+	MissNotify
+)
+
+// DeadlineMiss describes a task missed its deadline
+type DeadlineMiss struct {
+	TaskID   string
+	Queue    string
+	Deadline time.Time
+	// Running tells whether the task missed it while running, otherwise while waiting
+	Running bool
+}
+
+// MissFunc is called when a task misses its deadline
+type MissFunc func(ctx context.Context, m DeadlineMiss)
+
+// DeadlineTask is a task with a deadline
+type DeadlineTask interface {
+	Task
+	WithDeadline(deadline time.Time) Task
+	OnDeadlineMiss(f MissFunc) Task
+}
+
+// DeadlineStats counts the tasks with deadlines of a scheduler
+type DeadlineStats struct {
+	Admitted      uint64 `json:"admitted"`
+	Rejected      uint64 `json:"rejected"`
+	MissedQueued  uint64 `json:"missed_queued"`
+	MissedRunning uint64 `json:"missed_running"`
+}
+
+// deadlineStats is the counters of DeadlineStats updated atomically
+type deadlineStats struct {
+	admitted      uint64
+	rejected      uint64
+	missedQueued  uint64
+	missedRunning uint64
+}
+
+// WithDeadlineAdmission makes the scheduler reject the tasks can't meet their deadlines
+// with ErrDeadlineUnmeetable, only the deadlines set by WithDeadline are checked, a timeout
+// just bounds the run
+func WithDeadlineAdmission() Option {
+	return func(s *Scheduler) {
+		s.deadlineAdmission = true
+	}
+}
+
+// WithMissPolicy sets what happens to the tasks miss their deadlines set by WithDeadline while
+// waiting, MissDrop is used by default. A task runs out of its timeout before it starts never
+// runs whatever the policy is.
+func WithMissPolicy(p MissPolicy) Option {
+	return func(s *Scheduler) {
+		s.missPolicy = p
+	}
+}
+
+// DeadlineStats returns the counters of the tasks with deadlines
+func (s *Scheduler) DeadlineStats() DeadlineStats {
+	return DeadlineStats{
+		Admitted:      atomic.LoadUint64(&s.deadlines.admitted),
+		Rejected:      atomic.LoadUint64(&s.deadlines.rejected),
+		MissedQueued:  atomic.LoadUint64(&s.deadlines.missedQueued),
+		MissedRunning: atomic.LoadUint64(&s.deadlines.missedRunning),
+	}
+}
+
+// feasible reports whether t can finish before its deadline. The tasks ahead of it are the
+// running ones and the waiting ones with earlier deadlines if the queue is sorted by
+// deadline, or all the waiting ones otherwise. Each of them is assumed to take the average
+// run time.
+func (s *Scheduler) feasible(t *task) bool {
+	if !s.deadlineAdmission || !t.hasDeadline() {
+		return true
+	}
+
+	now := s.clock.Now()
+	if !t.deadline.After(now) {
+		return false
+	}
+
+	avg := s.averageRun()
+	if avg == 0 {
+		return true
+	}
+
+	ahead := 0
+	for _, queued := range s.queue.Tasks() {
+		other, ok := queued.(*task)
+		if !ok || other == t {
+			continue
+		}
+
+		if !s.edf || (!other.deadline.IsZero() && !other.deadline.After(t.deadline)) {
+			ahead++
+		}
+	}
+
+	s.runMu.Lock()
+	ahead += len(s.running)
+	s.runMu.Unlock()
+
+	workers := s.Workers()
+	if workers <= 0 {
+		workers = 1
+	}
+
+	finish := now.Add(time.Duration(ahead/workers+1) * avg)
+	return !finish.After(t.deadline)
+}
+
+// hasDeadline reports whether t has a deadline set by WithDeadline, the one derived from a
+// timeout only bounds the run, so it isn't admitted, dropped or counted as missed
+func (t *task) hasDeadline() bool {
+	return !t.deadline.IsZero() && t.timeout == 0
+}
+
+// admitDeadline checks a task with a deadline and counts it if it's rejected, it's counted
+// as admitted by admittedDeadline once it's queued
+func (s *Scheduler) admitDeadline(t *task) error {
+	if !t.hasDeadline() {
+		return nil
+	}
+
+	if !s.feasible(t) {
+		atomic.AddUint64(&s.deadlines.rejected, 1)
+		s.metrics.AddCounter("deadline_rejected_total", map[string]string{"queue": s.name}, 1)
+		return ErrDeadlineUnmeetable
+	}
+
+	return nil
+}
+
+// admittedDeadline counts a task with a deadline has passed all the checks and is queued
+func (s *Scheduler) admittedDeadline(t *task) {
+	if t.hasDeadline() {
+		atomic.AddUint64(&s.deadlines.admitted, 1)
+	}
+}
+
+// watchDeadline handles t if it's still waiting when its deadline passes
+func (s *Scheduler) watchDeadline(t *task) {
+	if !t.hasDeadline() {
+		return
+	}
+
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	if t.missTimer != nil {
+		return
+	}
+
+	t.missTimer = s.clock.AfterFunc(t.deadline.Sub(s.clock.Now()), func() {
+		if s.isRunning(t) {
+			return
+		}
+
+		if s.missPolicy == MissNotify {
+			if s.isTracked(t) {
+				s.missed(t, false)
+			}
+			return
+		}
+
+		if s.queue.Remove(t) {
+			s.missed(t, false)
+			t.complete(Outcome{Err: context.DeadlineExceeded, Attempt: t.attempts, Reason: context.DeadlineExceeded})
+		}
+	})
+}
+
+// missed reports that t missed its deadline, only once for a task
+func (s *Scheduler) missed(t *task, running bool) {
+	if !atomic.CompareAndSwapInt32(&t.missed, 0, 1) {
+		return
+	}
+
+	stage := "queued"
+	if running {
+		stage = "running"
+		atomic.AddUint64(&s.deadlines.missedRunning, 1)
+	} else {
+		atomic.AddUint64(&s.deadlines.missedQueued, 1)
+	}
+
+	s.logger.Warn("task missed deadline", "task", t.id, "stage", stage)
+	s.metrics.AddCounter("deadline_missed_total", map[string]string{"queue": s.name, "stage": stage}, 1)
+	s.emit(Event{Type: EventDeadlineMissed, TaskID: t.id, Message: stage, Err: context.DeadlineExceeded})
+
+	m := DeadlineMiss{TaskID: t.id, Queue: s.name, Deadline: t.deadline, Running: running}
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, f := range t.missFuncs {
+		f(ctx, m)
+	}
+}
+
+// isTracked reports whether t is scheduled and not completed
+func (s *Scheduler) isTracked(t *task) bool {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	return s.tasks[t.id] == t
+}
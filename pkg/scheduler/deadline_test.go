@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadlineAdmission(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock), WithDeadlineAdmission())
+	go s.Start(1)
+
+	// the average run time is 50ms then
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		<-clock.After(50 * time.Millisecond)
+		return nil
+	}))
+	clock.BlockUntil(1)
+	clock.Advance(50 * time.Millisecond)
+	s.Wait()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+
+	err := s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithDeadline(clock.Now().Add(10 * time.Millisecond)))
+	if !errors.Is(err, ErrDeadlineUnmeetable) {
+		t.Errorf("error is expected as %v, actually %v", ErrDeadlineUnmeetable, err)
+	}
+
+	err = s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithDeadline(clock.Now().Add(time.Minute)))
+	if err != nil {
+		t.Errorf("task with a loose deadline is expected to be admitted, actually %v", err)
+	}
+
+	// a task rejected by the later checks isn't counted as admitted
+	err = s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithDeadline(clock.Now().Add(time.Minute)).(SelectorTask).WithSelector(Selector{Required: []Requirement{{Key: "gpu", Op: OpExists}}}))
+	if !errors.Is(err, ErrUnschedulable) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnschedulable, err)
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	if stats := s.DeadlineStats(); stats.Admitted != 1 || stats.Rejected != 1 {
+		t.Errorf("stats are unexpected: %+v", stats)
+	}
+}
+
+func TestDeadlineMiss(t *testing.T) {
+	for _, policy := range []MissPolicy{MissDrop, MissNotify} {
+		clock := NewFakeClock(time.Now())
+		s := New(WithClock(clock), WithMissPolicy(policy))
+		go s.Start(1)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}))
+		<-started
+
+		misses, outcomes := make(chan DeadlineMiss, 1), make(chan Outcome, 1)
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return nil
+		}).WithDeadline(clock.Now().Add(time.Second)).(DeadlineTask).OnDeadlineMiss(func(ctx context.Context, m DeadlineMiss) {
+			misses <- m
+		}).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			outcomes <- o
+		}))
+
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+
+		if m := <-misses; m.Running || m.Queue != "default" {
+			t.Errorf("policy %d: miss is unexpected: %+v", policy, m)
+		}
+
+		close(release)
+		o := <-outcomes
+		switch policy {
+		case MissDrop:
+			if o.Reason != context.DeadlineExceeded || o.Attempt != 0 {
+				t.Errorf("dropped task is expected never to run, actually %+v", o)
+			}
+		case MissNotify:
+			if !o.Succeeded() || o.Attempt != 1 {
+				t.Errorf("late task is expected to run, actually %+v", o)
+			}
+		}
+
+		s.Wait()
+		s.Stop()
+
+		if stats := s.DeadlineStats(); stats.MissedQueued != 1 || stats.MissedRunning != 0 {
+			t.Errorf("policy %d: stats are unexpected: %+v", policy, stats)
+		}
+	}
+}
+
+func TestTimeoutNotAdmitted(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock), WithDeadlineAdmission())
+	go s.Start(1)
+
+	// the average run time is a minute then
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		<-clock.After(time.Minute)
+		return nil
+	}))
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	s.Wait()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+
+	// a timeout only bounds the run as before, the task isn't rejected nor dropped while waiting
+	outcomes := make(chan Outcome, 1)
+	err := s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithTimeout(time.Second).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+	if err != nil {
+		t.Fatalf("task with a timeout is expected to be admitted, actually %v", err)
+	}
+
+	close(release)
+	if o := <-outcomes; !o.Succeeded() {
+		t.Errorf("task with a timeout is expected to run, actually %+v", o)
+	}
+
+	s.Wait()
+	s.Stop()
+
+	if stats := s.DeadlineStats(); stats != (DeadlineStats{}) {
+		t.Errorf("tasks with timeouts aren't expected in the stats: %+v", stats)
+	}
+}
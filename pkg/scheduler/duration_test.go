@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	data, err := json.Marshal(Duration(90 * time.Second))
+	if err != nil || string(data) != `"1m30s"` {
+		t.Errorf("duration is expected as \"1m30s\", actually %s %v", data, err)
+	}
+
+	tests := []struct {
+		data     string
+		expected time.Duration
+		invalid  bool
+	}{
+		{data: `"30m"`, expected: 30 * time.Minute},
+		{data: `1000000000`, expected: time.Second},
+		{data: `"30 minutes"`, invalid: true},
+		{data: `true`, invalid: true},
+	}
+
+	for _, test := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(test.data), &d)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s is expected to be invalid, actually %v", test.data, time.Duration(d))
+			}
+			continue
+		}
+
+		if err != nil || time.Duration(d) != test.expected {
+			t.Errorf("%s is expected as %v, actually %v %v", test.data, test.expected, time.Duration(d), err)
+		}
+	}
+}
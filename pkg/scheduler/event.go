@@ -0,0 +1,72 @@
+package scheduler
+
+import "time"
+
+// EventType is the kind of an Event
+type EventType string
+
+const (
+	// EventBreakerOpen is emitted when a circuit breaker trips
+	EventBreakerOpen EventType = "breaker_open"
+	// EventBreakerHalfOpen is emitted when a circuit breaker starts letting probes through
+	EventBreakerHalfOpen EventType = "breaker_half_open"
+	// EventBreakerClosed is emitted when a circuit breaker recovers
+	EventBreakerClosed EventType = "breaker_closed"
+	// EventTaskProgress is emitted when a running task reports its progress
+	EventTaskProgress EventType = "task_progress"
+	// EventTaskStalled is emitted when a running task misses its heartbeat
+	EventTaskStalled EventType = "task_stalled"
+	// EventDeadlineMissed is emitted when a task misses its deadline, Message tells whether
+	// it's queued or running
+	EventDeadlineMissed EventType = "deadline_missed"
+	// EventTaskUnschedulable is emitted when a task requires a worker the scheduler doesn't have
+	EventTaskUnschedulable EventType = "task_unschedulable"
+	// EventTaskExpired is emitted when a task isn't started within its time-to-live
+	EventTaskExpired EventType = "task_expired"
+	// EventTaskShed is emitted when a waiting task is shed from an overloaded queue
+	EventTaskShed EventType = "task_shed"
+)
+
+// Event is something happened in the scheduler worth telling the observers
+type Event struct {
+	Type   EventType
+	TaskID string
+	// Name is the name of the object the event is about, such as a circuit breaker
+	Name     string
+	Err      error
+	Progress float64
+	Message  string
+	Time     time.Time
+}
+
+// Observer receives the events of a scheduler, OnEvent is called synchronously so it
+// should return quickly
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc is a wrapper for observer function
+type ObserverFunc func(e Event)
+
+// OnEvent is the Observer interface implementation for type ObserverFunc
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// WithObserver adds an observer receives the events of the scheduler
+func WithObserver(o Observer) Option {
+	return func(s *Scheduler) {
+		s.observers = append(s.observers, o)
+	}
+}
+
+// emit tells all the observers about e
+func (s *Scheduler) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = s.clock.Now()
+	}
+
+	for _, o := range s.observers {
+		o.OnEvent(e)
+	}
+}
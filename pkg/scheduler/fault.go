@@ -0,0 +1,244 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrInjected is the error of the faults injected into the tasks
+	ErrInjected = errors.New("injected fault")
+	// ErrInvalidFault is returned when a fault rule can't be used
+	ErrInvalidFault = errors.New("invalid fault rule")
+)
+
+// FaultKind is what a fault rule does to a task
+type FaultKind string
+
+const (
+	// FaultError fails the task with ErrInjected without running it
+	FaultError FaultKind = "error"
+	// FaultPanic panics instead of running the task
+	FaultPanic FaultKind = "panic"
+	// FaultDelay runs the task after the delay, a long one makes the task look hung
+	FaultDelay FaultKind = "delay"
+	// FaultCancel cancels the context of the task after the delay, while it's running
+	FaultCancel FaultKind = "cancel"
+)
+
+// FaultRule injects a fault into the tasks it matches, the empty conditions match any task
+type FaultRule struct {
+	Name string    `json:"name"`
+	Kind FaultKind `json:"kind"`
+	// Probability is the chance a matched run gets the fault
+	Probability float64 `json:"probability"`
+	// Delay is used by FaultDelay and FaultCancel
+	Delay   Duration `json:"delay,omitempty"`
+	Message string   `json:"message,omitempty"`
+
+	// Type is the type of the task as in TaskInfo
+	Type     string `json:"type,omitempty"`
+	IDPrefix string `json:"id_prefix,omitempty"`
+	Queue    string `json:"queue,omitempty"`
+	// Labels requires the labels of the worker runs the task
+	Labels Selector `json:"labels,omitempty"`
+}
+
+// Validate checks whether r can be used
+func (r FaultRule) Validate() error {
+	switch r.Kind {
+	case FaultError, FaultPanic, FaultCancel:
+	case FaultDelay:
+		if r.Delay <= 0 {
+			return fmt.Errorf("%w: %s needs a delay", ErrInvalidFault, r.Name)
+		}
+	default:
+		return fmt.Errorf("%w: %s has unknown kind %q", ErrInvalidFault, r.Name, r.Kind)
+	}
+
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("%w: %s has probability %v out of [0, 1]", ErrInvalidFault, r.Name, r.Probability)
+	}
+	if r.Delay < 0 {
+		return fmt.Errorf("%w: %s has negative delay", ErrInvalidFault, r.Name)
+	}
+
+	return nil
+}
+
+// matches reports whether r applies to the task described by info
+func (r FaultRule) matches(info TaskInfo) bool {
+	return (r.Type == "" || r.Type == info.Type) &&
+		strings.HasPrefix(info.ID, r.IDPrefix) &&
+		(r.Queue == "" || r.Queue == info.Queue) &&
+		r.Labels.Matches(info.Labels)
+}
+
+// FaultStatus is the state of a FaultInjector
+type FaultStatus struct {
+	Enabled bool        `json:"enabled"`
+	Rules   []FaultRule `json:"rules"`
+	// Injected counts the faults injected by the rule names
+	Injected map[string]uint64 `json:"injected"`
+}
+
+// FaultInjector injects faults into the tasks of a scheduler to exercise the retry and
+// recovery paths, it's disabled until Enable is called
+type FaultInjector struct {
+	sche    *Scheduler
+	enabled int32
+
+	mu       sync.Mutex
+	rules    []FaultRule
+	injected map[string]uint64
+	rand     *rand.Rand
+}
+
+// newFaultInjector returns a disabled FaultInjector of s
+func newFaultInjector(s *Scheduler) *FaultInjector {
+	return &FaultInjector{
+		sche:     s,
+		injected: map[string]uint64{},
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Faults returns the fault injector of the scheduler
+func (s *Scheduler) Faults() *FaultInjector {
+	return s.faults
+}
+
+// Enable starts injecting faults
+func (f *FaultInjector) Enable() {
+	atomic.StoreInt32(&f.enabled, 1)
+	f.sche.logger.Warn("fault injection enabled")
+}
+
+// Disable stops injecting faults
+func (f *FaultInjector) Disable() {
+	atomic.StoreInt32(&f.enabled, 0)
+	f.sche.logger.Info("fault injection disabled")
+}
+
+// Enabled reports whether faults are injected
+func (f *FaultInjector) Enabled() bool {
+	return atomic.LoadInt32(&f.enabled) == 1
+}
+
+// SetRules replaces the rules. The rules are tried in order, the first one matches a run and
+// hits its probability decides the fault, a missed one lets the rules after it have a try.
+func (f *FaultInjector) SetRules(rules []FaultRule) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append([]FaultRule(nil), rules...)
+	return nil
+}
+
+// Status returns the rules and the faults injected so far
+func (f *FaultInjector) Status() FaultStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := FaultStatus{
+		Enabled:  f.Enabled(),
+		Rules:    append([]FaultRule{}, f.rules...),
+		Injected: map[string]uint64{},
+	}
+	for name, n := range f.injected {
+		status.Injected[name] = n
+	}
+
+	return status
+}
+
+// pick returns the first matched rule hits its probability for this run
+func (f *FaultInjector) pick(info TaskInfo) (FaultRule, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range f.rules {
+		if !r.matches(info) {
+			continue
+		}
+
+		if f.rand.Float64() >= r.Probability {
+			continue
+		}
+
+		f.injected[r.Name]++
+		return r, true
+	}
+
+	return FaultRule{}, false
+}
+
+// middleware is the Middleware injects the faults
+func (f *FaultInjector) middleware(next Handler) Handler {
+	return func(ctx context.Context, info TaskInfo) error {
+		if !f.Enabled() {
+			return next(ctx, info)
+		}
+
+		r, ok := f.pick(info)
+		if !ok {
+			return next(ctx, info)
+		}
+
+		f.sche.logger.Warn("fault injected", "task", info.ID, "rule", r.Name, "kind", r.Kind)
+		f.sche.metrics.AddCounter("faults_injected_total", map[string]string{"queue": info.Queue, "rule": r.Name, "kind": string(r.Kind)}, 1)
+
+		switch r.Kind {
+		case FaultError:
+			return fmt.Errorf("%w: %s %s", ErrInjected, r.Name, r.Message)
+		case FaultPanic:
+			panic(fmt.Sprintf("%v: %s %s", ErrInjected, r.Name, r.Message))
+		case FaultDelay:
+			select {
+			case <-f.sche.clock.After(time.Duration(r.Delay)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case FaultCancel:
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel()
+
+			timer := f.sche.clock.AfterFunc(time.Duration(r.Delay), cancel)
+			defer timer.Stop()
+		}
+
+		return next(ctx, info)
+	}
+}
+
+// taskType returns the type of the task t wraps, as the Type of TaskInfo
+func taskType(t *task) string {
+	if t.typ != "" {
+		return t.typ
+	}
+	if t.spec != nil {
+		return t.spec.Handler
+	}
+
+	switch t.task.(type) {
+	case TaskFunc:
+		return "func"
+	case *JsTask:
+		return "js"
+	}
+
+	return fmt.Sprintf("%T", t.task)
+}
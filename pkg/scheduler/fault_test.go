@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFaultInjection(t *testing.T) {
+	s := New()
+	go s.Start(1)
+
+	err := s.Faults().SetRules([]FaultRule{
+		{Name: "flaky", Kind: FaultError, Probability: 1, IDPrefix: "flaky-"},
+		{Name: "crash", Kind: FaultPanic, Probability: 1, IDPrefix: "crash-"},
+		{Name: "cancel", Kind: FaultCancel, Probability: 1, Type: "func", IDPrefix: "cancel-"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outcomes := make(chan Outcome, 1)
+	run := func(id string, f TaskFunc) Outcome {
+		s.Schedule(f.WithRetry(1).(IdentifiedTask).WithID(id).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			outcomes <- o
+		}))
+		return <-outcomes
+	}
+
+	ran := 0
+	succeed := func(ctx context.Context) error {
+		ran++
+		return nil
+	}
+
+	if o := run("flaky-1", succeed); !o.Succeeded() || ran != 1 {
+		t.Errorf("faults aren't expected before they are enabled, actually %+v", o)
+	}
+
+	s.Faults().Enable()
+	if o := run("flaky-2", succeed); !errors.Is(o.Err, ErrInjected) || o.Attempt != 2 || ran != 1 {
+		t.Errorf("injected error is expected to be retried without running the task, actually %+v", o)
+	}
+
+	if o := run("crash-1", succeed); o.Err == nil || !strings.Contains(o.Err.Error(), "panic") {
+		t.Errorf("injected panic is expected to fail the task, actually %+v", o)
+	}
+
+	o := run("cancel-1", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(o.Err, context.Canceled) || o.Reason != nil || o.Attempt != 2 {
+		t.Errorf("task is expected to see its context cancelled, actually %+v", o)
+	}
+
+	if o := run("other-1", succeed); !o.Succeeded() {
+		t.Errorf("task isn't expected to match the rules, actually %+v", o)
+	}
+
+	s.Faults().Disable()
+	if o := run("flaky-3", succeed); !o.Succeeded() {
+		t.Errorf("faults aren't expected after they are disabled, actually %+v", o)
+	}
+
+	s.Wait()
+	s.Stop()
+
+	status := s.Faults().Status()
+	if status.Enabled || status.Injected["flaky"] != 2 || status.Injected["crash"] != 2 || status.Injected["cancel"] != 2 {
+		t.Errorf("status is unexpected: %+v", status)
+	}
+
+	if err := s.Faults().SetRules([]FaultRule{{Name: "slow", Kind: FaultDelay, Probability: 1}}); !errors.Is(err, ErrInvalidFault) {
+		t.Errorf("error is expected as %v, actually %v", ErrInvalidFault, err)
+	}
+}
+
+func TestFaultInjectionByType(t *testing.T) {
+	s := New()
+	go s.Start(1)
+
+	// the rule missing its probability lets the next one have a try
+	err := s.Faults().SetRules([]FaultRule{
+		{Name: "never", Kind: FaultPanic, Probability: 0},
+		{Name: "node", Kind: FaultError, Probability: 1, Type: "node"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Faults().Enable()
+
+	outcomes := make(chan Outcome, 1)
+	run := func(typ string) Outcome {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return nil
+		}).WithType(typ).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			outcomes <- o
+		}))
+		return <-outcomes
+	}
+
+	if o := run("node"); !errors.Is(o.Err, ErrInjected) {
+		t.Errorf("the node task is expected to get the fault, actually %+v", o)
+	}
+	if o := run("sh"); !o.Succeeded() {
+		t.Errorf("the sh task isn't expected to match the rules, actually %+v", o)
+	}
+
+	s.Wait()
+	s.Stop()
+
+	if status := s.Faults().Status(); status.Injected["never"] != 0 || status.Injected["node"] != 1 {
+		t.Errorf("status is unexpected: %+v", status)
+	}
+}
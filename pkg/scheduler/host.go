@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/robertkrimen/otto"
+)
+
+// ErrNotGranted is returned when a script uses a capability it isn't granted
+var ErrNotGranted = errors.New("capability not granted")
+
+// maxFetchBody is the largest response body a script can fetch
+const maxFetchBody = 10 << 20
+
+// HostFunc is a function of a capability, it's called with the context of the task and the
+// exported arguments of the script, and the value returned is passed back to the script
+type HostFunc func(ctx context.Context, args []interface{}) (interface{}, error)
+
+// Capability is a host API exposed to the scripts as a global object of functions
+type Capability struct {
+	Name  string
+	Funcs map[string]HostFunc
+}
+
+// HostAPI is the capabilities offered to a script, only the Granted ones can be used and the
+// others throw ErrNotGranted when they are called
+type HostAPI struct {
+	Capabilities []Capability
+	Granted      []string
+}
+
+// granted reports whether the capability named name is granted
+func (api HostAPI) granted(name string) bool {
+	for _, g := range api.Granted {
+		if g == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetHostAPI sets the host API of the script
+func (t *JsTask) SetHostAPI(api HostAPI) {
+	t.host = api
+}
+
+// deniedMessage returns the message of the CapabilityError thrown when the script calls the
+// ungranted capability name
+func deniedMessage(name string) string {
+	return fmt.Sprintf("%v: %s isn't granted to the script", ErrNotGranted, name)
+}
+
+// install sets the capabilities of the host API as globals of vm, denied is called with the
+// name of an ungranted capability when the script calls it
+func (api HostAPI) install(ctx context.Context, vm *otto.Otto, denied func(name string)) error {
+	for _, c := range api.Capabilities {
+		c, granted := c, api.granted(c.Name)
+
+		funcs := map[string]interface{}{}
+		for name, f := range c.Funcs {
+			f := f
+			if !granted {
+				funcs[name] = func(otto.FunctionCall) otto.Value {
+					denied(c.Name)
+					panic(vm.MakeCustomError("CapabilityError", deniedMessage(c.Name)))
+				}
+				continue
+			}
+
+			funcs[name] = func(call otto.FunctionCall) otto.Value {
+				args := make([]interface{}, len(call.ArgumentList))
+				for i, arg := range call.ArgumentList {
+					v, err := arg.Export()
+					if err != nil {
+						panic(vm.MakeTypeError(err.Error()))
+					}
+					args[i] = v
+				}
+
+				result, err := f(ctx, args)
+				if err != nil {
+					panic(vm.MakeCustomError("HostError", fmt.Sprintf("%s.%s: %v", c.Name, name, err)))
+				}
+
+				value, err := vm.ToValue(result)
+				if err != nil {
+					panic(vm.MakeTypeError(err.Error()))
+				}
+				return value
+			}
+		}
+
+		if err := vm.Set(c.Name, funcs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LogCapability is the "log" capability, log.info(message, fields) and the other levels
+// write to the logger of the scheduler with the id of the task
+func LogCapability() Capability {
+	level := func(write func(l Logger) func(msg string, keyvals ...interface{})) HostFunc {
+		return func(ctx context.Context, args []interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, errors.New("no message")
+			}
+
+			logger, keyvals := defaultLogger, []interface{}{}
+			if e, ok := ctx.Value(reporterKey{}).(*execution); ok {
+				logger = e.task.logger()
+				keyvals = append(keyvals, "task", e.task.id)
+			}
+
+			if len(args) > 1 {
+				fields, ok := args[1].(map[string]interface{})
+				if !ok {
+					return nil, errors.New("fields aren't an object")
+				}
+				for k, v := range fields {
+					keyvals = append(keyvals, k, v)
+				}
+			}
+
+			write(logger)(fmt.Sprint(args[0]), keyvals...)
+			return nil, nil
+		}
+	}
+
+	return Capability{
+		Name: "log",
+		Funcs: map[string]HostFunc{
+			"debug": level(func(l Logger) func(string, ...interface{}) { return l.Debug }),
+			"info":  level(func(l Logger) func(string, ...interface{}) { return l.Info }),
+			"warn":  level(func(l Logger) func(string, ...interface{}) { return l.Warn }),
+			"error": level(func(l Logger) func(string, ...interface{}) { return l.Error }),
+		},
+	}
+}
+
+// FetchCapability is the "http" capability, http.fetch(url, {method, headers, body}) returns
+// {status, headers, body} of the response. Only the hosts in allow can be fetched, a
+// "*.example.com" entry allows the subdomains of example.com.
+func FetchCapability(client *http.Client, allow []string) Capability {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	fetch := func(ctx context.Context, args []interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("no url")
+		}
+
+		u, err := url.Parse(fmt.Sprint(args[0]))
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("scheme %q isn't supported", u.Scheme)
+		}
+		if !hostAllowed(u.Hostname(), allow) {
+			return nil, fmt.Errorf("host %s isn't allowed", u.Hostname())
+		}
+
+		method, headers, body := http.MethodGet, map[string]interface{}{}, ""
+		if len(args) > 1 {
+			options, ok := args[1].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("options aren't an object")
+			}
+			if m, ok := options["method"].(string); ok {
+				method = strings.ToUpper(m)
+			}
+			if h, ok := options["headers"].(map[string]interface{}); ok {
+				headers = h
+			}
+			if b, ok := options["body"].(string); ok {
+				body = b
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, fmt.Sprint(v))
+		}
+
+		// the redirects are checked against the allowlist too
+		c := *client
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if !hostAllowed(req.URL.Hostname(), allow) {
+				return fmt.Errorf("redirect to host %s isn't allowed", req.URL.Hostname())
+			}
+			if len(via) >= 10 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		}
+
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBody+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxFetchBody {
+			return nil, fmt.Errorf("response body is larger than %d bytes", maxFetchBody)
+		}
+
+		respHeaders := map[string]interface{}{}
+		for k := range resp.Header {
+			respHeaders[strings.ToLower(k)] = resp.Header.Get(k)
+		}
+
+		return map[string]interface{}{
+			"status":  resp.StatusCode,
+			"headers": respHeaders,
+			"body":    string(data),
+		}, nil
+	}
+
+	return Capability{
+		Name:  "http",
+		Funcs: map[string]HostFunc{"fetch": fetch},
+	}
+}
+
+// hostAllowed reports whether host matches an entry of allow
+func hostAllowed(host string, allow []string) bool {
+	host = strings.ToLower(host)
+	for _, a := range allow {
+		a = strings.ToLower(a)
+		if strings.HasPrefix(a, "*.") {
+			if strings.HasSuffix(host, a[1:]) {
+				return true
+			}
+			continue
+		}
+
+		if host == a {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		fmt.Fprintf(w, "hello %s", r.URL.Query().Get("name"))
+	}))
+	defer server.Close()
+
+	store := map[string]interface{}{}
+	kv := Capability{
+		Name: "kv",
+		Funcs: map[string]HostFunc{
+			"get": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				return store[args[0].(string)], nil
+			},
+			"set": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				store[args[0].(string)] = args[1]
+				return nil, nil
+			},
+		},
+	}
+
+	run := func(script string, granted ...string) (*JsTask, error) {
+		task := NewJsTask(script)
+		task.SetParam("url", server.URL)
+		task.SetHostAPI(HostAPI{
+			Capabilities: []Capability{FetchCapability(nil, []string{"127.0.0.1"}), kv, LogCapability()},
+			Granted:      granted,
+		})
+		return task, task.Do(context.Background())
+	}
+
+	_, err := run(`
+		var resp = http.fetch(url + "?name=cerebus", {method: "post"});
+		kv.set("greeting", resp.body + " " + resp.headers["x-method"] + " " + resp.status);
+		log.info("fetched", {status: resp.status});
+	`, "http", "kv", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store["greeting"] != "hello cerebus POST 200" {
+		t.Errorf("greeting is unexpected: %v", store["greeting"])
+	}
+
+	if _, err := run(`kv.get("greeting")`, "http"); !errors.Is(err, ErrNotGranted) || !strings.Contains(err.Error(), "kv") {
+		t.Errorf("error is expected as %v of kv, actually %v", ErrNotGranted, err)
+	}
+
+	_, err = run(`
+		var message;
+		try { kv.get("greeting") } catch (e) { message = e.message }
+		kv.set
+	`)
+	if err != nil {
+		t.Errorf("caught error isn't expected to fail the script, actually %v", err)
+	}
+
+	_, err = run(`
+		try { kv.get("greeting") } catch (e) {}
+		throw new Error("unrelated")
+	`)
+	if err == nil || errors.Is(err, ErrNotGranted) {
+		t.Errorf("error after a caught denial isn't expected as %v, actually %v", ErrNotGranted, err)
+	}
+
+	if _, err := run(`http.fetch("http://example.com")`, "http"); err == nil || !strings.Contains(err.Error(), "isn't allowed") {
+		t.Errorf("host out of the allowlist is expected to be refused, actually %v", err)
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	allow := []string{"api.example.com", "*.cdn.example.com"}
+	cases := map[string]bool{
+		"api.example.com":     true,
+		"API.example.com":     true,
+		"a.cdn.example.com":   true,
+		"cdn.example.com":     false,
+		"example.com":         false,
+		"evilcdn.example.com": false,
+	}
+
+	for host, expected := range cases {
+		if hostAllowed(host, allow) != expected {
+			t.Errorf("%s is expected to be allowed %v", host, expected)
+		}
+	}
+}
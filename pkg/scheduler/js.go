@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/robertkrimen/otto"
+)
+
+// errHalt is panicked in the runtime of a JsTask to stop the script when its context is done
+var errHalt = errors.New("script halted")
+
+// SetOutput makes console.log of the script write to w instead of the stdout
+func (t *JsTask) SetOutput(w io.Writer) {
+	t.output = w
+}
+
+// SetErrorOutput makes console.warn and console.error of the script write to w, instead of
+// the output set by SetOutput
+func (t *JsTask) SetErrorOutput(w io.Writer) {
+	t.errOutput = w
+}
+
+// Do runs the script in a copy of the runtime, so that a retry doesn't see the globals of
+// the last attempt, with the capabilities of its host API. The script is interrupted once
+// ctx is done, and the value of its last statement is set as the result of the task.
+func (t *JsTask) Do(ctx context.Context) (err error) {
+	vm := t.vm.Copy()
+	if t.output != nil || t.errOutput != nil {
+		if err := vm.Set("console", console(t.output, t.errOutput)); err != nil {
+			return err
+		}
+	}
+
+	// the ungranted capabilities called, so that the error says why the script failed
+	denied := map[string]bool{}
+	err = t.host.install(ctx, vm, func(name string) {
+		denied[name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	vm.Interrupt = make(chan func(), 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			vm.Interrupt <- func() {
+				panic(errHalt)
+			}
+		case <-done:
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errHalt {
+				panic(r)
+			}
+			err = ctx.Err()
+		}
+	}()
+
+	value, err := vm.Run(t.script)
+	if err != nil {
+		// the script may catch the CapabilityError and fail for another reason
+		for name := range denied {
+			if err.Error() == "CapabilityError: "+deniedMessage(name) {
+				return fmt.Errorf("%w: %s: %v", ErrNotGranted, name, err)
+			}
+		}
+		return err
+	}
+
+	if !value.IsUndefined() {
+		result, err := value.Export()
+		if err != nil {
+			return err
+		}
+		SetResult(ctx, result)
+	}
+
+	return nil
+}
+
+// console returns the console object of the scripts writes the lines to out, and the
+// warnings and errors to errOut, either of them is used for both if the other is nil
+func console(out, errOut io.Writer) map[string]interface{} {
+	if out == nil {
+		out = errOut
+	}
+	if errOut == nil {
+		errOut = out
+	}
+
+	printTo := func(w io.Writer) func(call otto.FunctionCall) otto.Value {
+		return func(call otto.FunctionCall) otto.Value {
+			args := make([]string, len(call.ArgumentList))
+			for i, arg := range call.ArgumentList {
+				args[i] = format(arg)
+			}
+			fmt.Fprintln(w, strings.Join(args, " "))
+
+			return otto.UndefinedValue()
+		}
+	}
+
+	return map[string]interface{}{
+		"log":   printTo(out),
+		"info":  printTo(out),
+		"debug": printTo(out),
+		"warn":  printTo(errOut),
+		"error": printTo(errOut),
+	}
+}
+
+// format returns v as console.log prints it, the objects are printed as JSON
+func format(v otto.Value) string {
+	if !v.IsObject() || v.Class() == "Function" || v.Class() == "Error" {
+		return v.String()
+	}
+
+	exported, err := v.Export()
+	if err != nil {
+		return v.String()
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		return v.String()
+	}
+
+	return string(data)
+}
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJsTask(t *testing.T) {
+	s := New()
+	go s.Start(1)
+
+	outcomes := make(chan Outcome, 1)
+	run := func(task *JsTask, timeout time.Duration) Outcome {
+		var tk Task = task
+		if timeout > 0 {
+			tk = task.WithTimeout(timeout)
+		}
+		s.Schedule(tk.(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			outcomes <- o
+		}))
+		return <-outcomes
+	}
+
+	var output bytes.Buffer
+	task := NewJsTask(`
+		console.log("count", count, typeof count, tags.length, opts.verbose);
+		console.log({sum: count + 1});
+		({count: count * 2, name: name});
+	`)
+	task.SetOutput(&output)
+	task.SetParam("count", 21)
+	task.SetParam("name", "answer")
+	task.SetParam("tags", []string{"a", "b"})
+	task.SetParam("opts", map[string]interface{}{"verbose": true})
+
+	o := run(task, 0)
+	if !o.Succeeded() {
+		t.Fatalf("script is expected to succeed, actually %v", o.Err)
+	}
+	if expected := "count 21 number 2 true\n{\"sum\":22}\n"; output.String() != expected {
+		t.Errorf("output is expected as %q, actually %q", expected, output.String())
+	}
+	if expected := map[string]interface{}{"count": float64(42), "name": "answer"}; !reflect.DeepEqual(o.Result, expected) {
+		t.Errorf("result is expected as %v, actually %#v", expected, o.Result)
+	}
+
+	if o := run(NewJsTask(`throw new Error("boom")`), 0); o.Err == nil {
+		t.Error("thrown error is expected to fail the task")
+	}
+
+	o = run(NewJsTask(`while (true) {}`), 50*time.Millisecond)
+	if o.Err == nil || errors.Is(o.Err, errHalt) {
+		t.Errorf("endless script is expected to be interrupted, actually %v", o.Err)
+	}
+
+	s.Wait()
+	s.Stop()
+}
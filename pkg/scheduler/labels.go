@@ -0,0 +1,145 @@
+package scheduler
+
+import "errors"
+
+// ErrUnschedulable is returned when no worker of the scheduler matches the required
+// selector of a task
+var ErrUnschedulable = errors.New("no worker matches the task selector")
+
+// Labels are the key/value pairs describe a worker, such as "runtime": "node"
+type Labels map[string]string
+
+// Operator is the relation between a label and the values of a Requirement
+type Operator string
+
+const (
+	// OpIn requires the label to be one of the values
+	OpIn Operator = "in"
+	// OpNotIn requires the label to be absent or not one of the values
+	OpNotIn Operator = "notin"
+	// OpExists requires the label to be present
+	OpExists Operator = "exists"
+	// OpDoesNotExist requires the label to be absent
+	OpDoesNotExist Operator = "!exists"
+)
+
+// Requirement is a condition on a label of the worker
+type Requirement struct {
+	Key    string   `json:"key"`
+	Op     Operator `json:"op"`
+	Values []string `json:"values,omitempty"`
+}
+
+// Matches reports whether labels satisfy r
+func (r Requirement) Matches(labels Labels) bool {
+	value, ok := labels[r.Key]
+
+	switch r.Op {
+	case OpIn:
+		return ok && contains(r.Values, value)
+	case OpNotIn:
+		return !ok || !contains(r.Values, value)
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	}
+
+	return false
+}
+
+// contains reports whether values has v
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Selector chooses the workers a task may run on. All the Required requirements must be
+// met, the worker meets the most Preferred requirements is chosen among the idle ones.
+type Selector struct {
+	Required  []Requirement `json:"required,omitempty"`
+	Preferred []Requirement `json:"preferred,omitempty"`
+}
+
+// MatchLabels returns the requirements that the labels equal to the ones given
+func MatchLabels(labels Labels) []Requirement {
+	var requirements []Requirement
+	for k, v := range labels {
+		requirements = append(requirements, Requirement{Key: k, Op: OpIn, Values: []string{v}})
+	}
+
+	return requirements
+}
+
+// Matches reports whether labels satisfy all the required requirements
+func (s Selector) Matches(labels Labels) bool {
+	for _, r := range s.Required {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// score counts the preferred requirements satisfied by labels
+func (s Selector) score(labels Labels) int {
+	score := 0
+	for _, r := range s.Preferred {
+		if r.Matches(labels) {
+			score++
+		}
+	}
+
+	return score
+}
+
+// workerGroup is a number of workers share the same labels
+type workerGroup struct {
+	size   int
+	labels Labels
+}
+
+// WithWorkerGroup adds n workers carry labels, they are started by Start along with the
+// unlabeled workers
+func WithWorkerGroup(n int, labels Labels) Option {
+	return func(s *Scheduler) {
+		s.groups = append(s.groups, workerGroup{size: n, labels: labels})
+	}
+}
+
+// placeable reports whether any worker of the scheduler can run a task with selector
+func (s *Scheduler) placeable(selector Selector) bool {
+	if selector.Matches(nil) {
+		return true
+	}
+
+	for _, g := range s.groups {
+		if g.size > 0 && selector.Matches(g.labels) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pick returns the index of the idle worker fits t best, -1 if none matches
+func pick(idle []*goroutineWorker, t *task) int {
+	best, bestScore := -1, -1
+	for i, w := range idle {
+		if !t.selector.Matches(w.labels) {
+			continue
+		}
+
+		if score := t.selector.score(w.labels); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return best
+}
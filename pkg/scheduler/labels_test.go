@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequirement(t *testing.T) {
+	labels := Labels{"runtime": "node", "zone": "minio"}
+	cases := []struct {
+		requirement Requirement
+		expected    bool
+	}{
+		{Requirement{Key: "runtime", Op: OpIn, Values: []string{"node", "python"}}, true},
+		{Requirement{Key: "runtime", Op: OpIn, Values: []string{"python"}}, false},
+		{Requirement{Key: "runtime", Op: OpNotIn, Values: []string{"python"}}, true},
+		{Requirement{Key: "trust", Op: OpNotIn, Values: []string{"untrusted"}}, true},
+		{Requirement{Key: "zone", Op: OpExists}, true},
+		{Requirement{Key: "zone", Op: OpDoesNotExist}, false},
+	}
+
+	for _, c := range cases {
+		if matched := c.requirement.Matches(labels); matched != c.expected {
+			t.Errorf("%+v is expected as %v, actually %v", c.requirement, c.expected, matched)
+		}
+	}
+}
+
+func TestAffinity(t *testing.T) {
+	s := New(WithWorkerGroup(1, Labels{"runtime": "node"}))
+	go s.Start(1)
+
+	node := Selector{Required: MatchLabels(Labels{"runtime": "node"})}
+	running, release := make(chan string, 3), make(chan struct{})
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "first node"
+		<-release
+		return nil
+	}).WithSelector(node))
+	<-running
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "second node"
+		return nil
+	}).WithSelector(node))
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "any"
+		return nil
+	}))
+
+	select {
+	case name := <-running:
+		if name != "any" {
+			t.Errorf("running is expected as any, actually %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("task without selector is expected to run on the unlabeled worker")
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	if name := <-running; name != "second node" {
+		t.Errorf("running is expected as second node, actually %s", name)
+	}
+}
+
+func TestUnschedulable(t *testing.T) {
+	events := make(chan Event, 1)
+	s := New(
+		WithWorkerGroup(1, Labels{"runtime": "node"}),
+		WithObserver(ObserverFunc(func(e Event) {
+			events <- e
+		})),
+	)
+
+	err := s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithSelector(Selector{Required: []Requirement{{Key: "gpu", Op: OpExists}}}))
+	if !errors.Is(err, ErrUnschedulable) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnschedulable, err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventTaskUnschedulable {
+			t.Errorf("event is expected as %s, actually %s", EventTaskUnschedulable, e.Type)
+		}
+	default:
+		t.Error("unschedulable event is expected")
+	}
+}
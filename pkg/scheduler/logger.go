@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is the structured logger used by the scheduler, keyvals are alternating keys
+// and values
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// defaultLogger is used before a task is bound to a scheduler
+var defaultLogger = NewStdLogger(log.Default())
+
+// stdLogger writes key=value lines to a log.Logger
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger returns a Logger writes to l
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+// Debug logs a message for debugging
+func (s *stdLogger) Debug(msg string, keyvals ...interface{}) { s.log("DEBUG", msg, keyvals) }
+
+// Info logs a message about the normal operation
+func (s *stdLogger) Info(msg string, keyvals ...interface{}) { s.log("INFO", msg, keyvals) }
+
+// Warn logs a message about something unexpected but recoverable
+func (s *stdLogger) Warn(msg string, keyvals ...interface{}) { s.log("WARN", msg, keyvals) }
+
+// Error logs a message about a failure
+func (s *stdLogger) Error(msg string, keyvals ...interface{}) { s.log("ERROR", msg, keyvals) }
+
+func (s *stdLogger) log(level, msg string, keyvals []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", level, msg)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, " %v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v=?", keyvals[i])
+		}
+	}
+
+	s.l.Print(b.String())
+}
+
+// nopLogger discards everything
+type nopLogger struct{}
+
+// NopLogger returns a Logger discards all messages
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics records the measurements of a scheduler, labels may be nil
+type Metrics interface {
+	AddCounter(name string, labels map[string]string, delta float64)
+	SetGauge(name string, labels map[string]string, value float64)
+}
+
+// WithMetrics sets where the scheduler records its measurements, nothing is recorded by default
+func WithMetrics(m Metrics) Option {
+	return func(s *Scheduler) {
+		s.metrics = m
+	}
+}
+
+// nopMetrics discards everything
+type nopMetrics struct{}
+
+func (nopMetrics) AddCounter(string, map[string]string, float64) {}
+func (nopMetrics) SetGauge(string, map[string]string, float64)   {}
+
+// MemoryMetrics keeps the measurements in memory, the keys are in the form of
+// name{key="value",...} with sorted label keys
+type MemoryMetrics struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewMemoryMetrics returns an empty MemoryMetrics
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		values: map[string]float64{},
+	}
+}
+
+// AddCounter adds delta to the counter
+func (m *MemoryMetrics) AddCounter(name string, labels map[string]string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[metricKey(name, labels)] += delta
+}
+
+// SetGauge sets the gauge to value
+func (m *MemoryMetrics) SetGauge(name string, labels map[string]string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[metricKey(name, labels)] = value
+}
+
+// Value returns the current value of a counter or gauge
+func (m *MemoryMetrics) Value(name string, labels map[string]string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.values[metricKey(name, labels)]
+}
+
+// Snapshot returns a copy of all the values
+func (m *MemoryMetrics) Snapshot() map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	values := make(map[string]float64, len(m.values))
+	for k, v := range m.values {
+		values[k] = v
+	}
+
+	return values
+}
+
+// metricKey formats the name and labels as name{key="value",...}
+func metricKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import "context"
+
+// TaskInfo is the metadata of a task seen by the middleware
+type TaskInfo struct {
+	ID string
+	// ParentID is the id of the task spawned this one, empty if it isn't a child
+	ParentID string
+	// Type is the type of the task, the one set by WithType, otherwise the handler name of a
+	// TaskSpec, "func" for TaskFunc and "js" for JsTask
+	Type string
+	// Attempt counts the runs before this one, it's 0 on the first run
+	Attempt uint
+	// Queue is the name of the scheduler
+	Queue    string
+	Priority int
+	Breaker  string
+	// Labels are the labels of the worker runs the task
+	Labels Labels
+}
+
+// Handler runs a task
+type Handler func(ctx context.Context, info TaskInfo) error
+
+// Middleware wraps a Handler, such as logging, tracing or locking around the tasks. The
+// middleware of the scheduler runs before the middleware of the task, both run in the order
+// they are added.
+type Middleware func(next Handler) Handler
+
+// MiddlewareTask is a task carries its own middleware
+type MiddlewareTask interface {
+	Task
+	Use(mw ...Middleware) Task
+}
+
+// WithName sets the name of the scheduler, which is the queue seen by the middleware
+func WithName(name string) Option {
+	return func(s *Scheduler) {
+		s.name = name
+	}
+}
+
+// Use adds middleware to all the tasks, it should be called before Start
+func (s *Scheduler) Use(mw ...Middleware) {
+	s.middleware = append(s.middleware, mw...)
+}
+
+// chain wraps h by mw, the first one is the outermost
+func chain(h Handler, mw []Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// startCallback is the middleware calls f before the task, an error is passed to the catch
+// function and doesn't stop the task
+func (t *task) startCallback(f CallbackFunc) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, info TaskInfo) error {
+			if err := f(ctx); err != nil {
+				t.callbackFailed(err)
+			}
+
+			return next(ctx, info)
+		}
+	}
+}
+
+// finishedCallback is the middleware calls f after the task succeeds, an error is passed to
+// the catch function
+func (t *task) finishedCallback(f CallbackFunc) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, info TaskInfo) error {
+			if err := next(ctx, info); err != nil {
+				return err
+			}
+
+			if err := f(ctx); err != nil {
+				t.callbackFailed(err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// callbackFailed passes the error of a callback to the catch function, or logs it if there
+// isn't one
+func (t *task) callbackFailed(err error) {
+	if t.catchFunc == nil {
+		t.logger().Warn("task callback failed", "task", t.id, "error", err)
+		return
+	}
+
+	t.catchFunc(err)
+}
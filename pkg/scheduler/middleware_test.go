@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var trace []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, info TaskInfo) error {
+				trace = append(trace, name+" before")
+				err := next(ctx, info)
+				trace = append(trace, name+" after")
+				return err
+			}
+		}
+	}
+
+	s := New()
+	s.Use(record("scheduler"))
+	go s.Start(1)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		trace = append(trace, "task")
+		return nil
+	}).AddStartCallback(func(ctx context.Context) error {
+		trace = append(trace, "start")
+		return nil
+	}).(MiddlewareTask).Use(record("task")).(CallbackTask).AddFinishedCallback(func(ctx context.Context) error {
+		trace = append(trace, "finished")
+		return nil
+	}))
+
+	s.Wait()
+	s.Stop()
+
+	expected := []string{
+		"scheduler before", "start", "task before", "task", "finished", "task after", "scheduler after",
+	}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("trace is expected as %v, actually %v", expected, trace)
+	}
+}
+
+func TestMiddlewareInfo(t *testing.T) {
+	var infos []TaskInfo
+	s := New(WithName("scripts"), WithWorkerGroup(1, Labels{"runtime": "node"}))
+	s.Use(func(next Handler) Handler {
+		return func(ctx context.Context, info TaskInfo) error {
+			infos = append(infos, info)
+			return next(ctx, info)
+		}
+	})
+	go s.Start(1)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return errors.New("test retry")
+	}).WithRetry(1).(IdentifiedTask).WithID("42").(SelectorTask).WithSelector(Selector{
+		Required: MatchLabels(Labels{"runtime": "node"}),
+	}))
+
+	s.Wait()
+	s.Stop()
+
+	if len(infos) != 2 {
+		t.Fatalf("attempts are expected as 2, actually %d", len(infos))
+	}
+	for i, info := range infos {
+		if info.ID != "42" || info.Attempt != uint(i) || info.Queue != "scripts" || info.Labels["runtime"] != "node" {
+			t.Errorf("info of attempt %d is unexpected: %+v", i, info)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+// Option configures a Scheduler
+type Option func(*Scheduler)
+
+// WorkerFactory creates the workers of a Scheduler, the worker should stop when stopCh is closed
+type WorkerFactory func(s *Scheduler, stopCh chan struct{}) Worker
+
+// WithQueue sets the queue stores the waiting tasks, NewQueue() is used by default
+func WithQueue(q Queue) Option {
+	return func(s *Scheduler) {
+		s.queue = q
+	}
+}
+
+// WithWorkerFactory sets the function creates the unlabeled workers, NewGoroutineWorker is used
+// by default. The tasks are handed to the workers NewGoroutineWorker returns, so f should wrap
+// one of them, such as to see in a test when the workers start.
+func WithWorkerFactory(f WorkerFactory) Option {
+	return func(s *Scheduler) {
+		s.workerFactory = f
+	}
+}
+
+// WithWorkers sets the number of workers used when Start is called with 0
+func WithWorkers(n int) Option {
+	return func(s *Scheduler) {
+		s.wsize = n
+	}
+}
+
+// WithLogger sets the logger, the standard logger is used by default
+func WithLogger(l Logger) Option {
+	return func(s *Scheduler) {
+		s.logger = l
+	}
+}
+
+// WithClock sets the source of time, RealClock() is used by default
+func WithClock(c Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCancelled is the error of a task whose context is cancelled
+var ErrCancelled = errors.New("Task cancel")
+
+// Outcome is how a task ends up
+type Outcome struct {
+	TaskID string
+	// Err is nil if the task succeeded
+	Err error
+	// Result is the value set by SetResult during the last attempt
+	Result interface{}
+	// Attempt is the number of the attempt produced the outcome. A task stopped before it
+	// runs again, such as cancelled, shed or refused by an open breaker while waiting for a
+	// retry, has the number of the attempts it ran, which is 0 if it never ran.
+	Attempt uint
+	// Start and End are the times of the last attempt
+	Start time.Time
+	End   time.Time
+	// Reason tells why the task is cancelled, it's one of ErrCancelled,
+	// context.DeadlineExceeded, ErrBreakerOpen, ErrDropped, ErrExpired, ErrShed and the error
+	// of the queue refused to take a retry such as ErrQueueFull, nil if it isn't cancelled
+	Reason error
+}
+
+// Succeeded reports whether the task succeeded
+func (o Outcome) Succeeded() bool {
+	return o.Err == nil
+}
+
+// Duration returns how long the last attempt ran
+func (o Outcome) Duration() time.Duration {
+	return o.End.Sub(o.Start)
+}
+
+// OutcomeFunc is called with the outcome of a task
+type OutcomeFunc func(ctx context.Context, o Outcome)
+
+// OutcomeTask is a task tells how it ends up.
+//
+// The outcome callbacks run exactly once for a scheduled task after its last attempt,
+// whether it succeeded, failed or never ran because it's cancelled, timed out, refused by
+// an open breaker or dropped by the queue. They run after the catch function and in the
+// order they are added. The retry hooks run after every failed attempt will be retried,
+// before the task is queued again, the outcome callbacks don't run for these attempts.
+type OutcomeTask interface {
+	Task
+	OnOutcome(f OutcomeFunc) Task
+	OnRetry(f OutcomeFunc) Task
+}
+
+// SetResult sets the result of the running task, it's passed to the outcome callbacks
+func SetResult(ctx context.Context, v interface{}) {
+	if e, ok := ctx.Value(reporterKey{}).(*execution); ok {
+		e.mu.Lock()
+		e.result = v
+		e.mu.Unlock()
+	}
+}
+
+// complete reports the final outcome of t
+func (t *task) complete(o Outcome) {
+	if t.sche != nil {
+		defer t.sche.untrack(t)
+	}
+
+	o.TaskID = t.id
+	if o.Err != nil && t.catchFunc != nil {
+		t.catchFunc(o.Err)
+	}
+
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, f := range t.outcomeFuncs {
+		f(ctx, o)
+	}
+
+	if t.sche != nil {
+		t.sche.dropCheckpoint(t)
+	}
+	if errors.Is(o.Reason, ErrCancelled) && t.sche != nil {
+		t.sche.cancelChildren(t)
+	}
+	if t.parentTask != nil {
+		t.parentTask.childDone(t, o)
+	}
+}
+
+// retry reports a failed attempt of t will be retried
+func (t *task) retry(o Outcome) {
+	o.TaskID = t.id
+
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, f := range t.retryFuncs {
+		f(ctx, o)
+	}
+}
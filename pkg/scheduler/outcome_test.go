@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOutcome(t *testing.T) {
+	var retries, outcomes []Outcome
+	var caught error
+	s := New()
+	go s.Start(1)
+
+	failed := errors.New("test outcome")
+	attempt := 0
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		attempt++
+		SetResult(ctx, attempt)
+		if attempt < 3 {
+			return failed
+		}
+		return nil
+	}).WithRetry(5).(CallbackTask).AddFinishedCallback(func(ctx context.Context) error {
+		if len(outcomes) != 0 {
+			t.Error("finished callbacks are expected to run before the outcome callbacks")
+		}
+		return nil
+	}).(OutcomeTask).OnRetry(func(ctx context.Context, o Outcome) {
+		retries = append(retries, o)
+	}).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes = append(outcomes, o)
+	}).(RetryTask).WithCatch(func(err error) {
+		caught = err
+	}))
+
+	s.Wait()
+	s.Stop()
+
+	if len(retries) != 2 {
+		t.Fatalf("retries are expected as 2, actually %d", len(retries))
+	}
+	for i, o := range retries {
+		if o.Err != failed || o.Attempt != uint(i+1) || o.Result != i+1 {
+			t.Errorf("retry %d is unexpected: %+v", i, o)
+		}
+	}
+
+	if len(outcomes) != 1 {
+		t.Fatalf("outcomes are expected as 1, actually %d", len(outcomes))
+	}
+	if o := outcomes[0]; !o.Succeeded() || o.Attempt != 3 || o.Result != 3 || o.Reason != nil || o.End.Before(o.Start) {
+		t.Errorf("outcome is unexpected: %+v", o)
+	}
+	if caught != nil {
+		t.Errorf("catch function isn't expected to be called, actually called with %v", caught)
+	}
+}
+
+func TestOutcomeCancelled(t *testing.T) {
+	outcomes := make(chan Outcome, 2)
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock))
+	go s.Start(2)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithTimeout(time.Second).(RetryTask).WithRetry(3).(OutcomeTask).OnRetry(func(ctx context.Context, o Outcome) {
+		t.Error("a timed out task isn't expected to be retried")
+	}).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+
+	task, cancel := TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithCancelFunc(0)
+	cancel()
+	s.Schedule(task.(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+
+	if o := <-outcomes; o.Reason != ErrCancelled || o.Attempt != 0 {
+		t.Errorf("outcome of the cancelled task is unexpected: %+v", o)
+	}
+
+	// the timeout of the running task
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if o := <-outcomes; o.Reason != context.DeadlineExceeded || o.Attempt != 1 {
+		t.Errorf("outcome of the timed out task is unexpected: %+v", o)
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestOutcomeRetryRejected(t *testing.T) {
+	outcomes := make(chan Outcome, 1)
+	s := New(WithQueue(NewChanQueue(1, Reject)))
+	go s.Start(1)
+
+	failed := errors.New("test retry rejected")
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		// the queue is full when the task is retried
+		if err := s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return nil
+		})); err != nil {
+			t.Errorf("filling the queue is expected to succeed, actually %v", err)
+		}
+		return failed
+	}).WithRetry(1).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+
+	select {
+	case o := <-outcomes:
+		if o.Err != ErrQueueFull || o.Reason != ErrQueueFull || o.Attempt != 1 {
+			t.Errorf("outcome is unexpected: %+v", o)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the outcome callbacks are expected to run when the retry is rejected")
+	}
+
+	s.Wait()
+	s.Stop()
+
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+	if n := len(s.tasks); n != 0 {
+		t.Errorf("no task is expected to be tracked, actually %d", n)
+	}
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Reporter lets a running task tell the scheduler how it's going, every call also counts
+// as a heartbeat
+type Reporter interface {
+	// Progress reports the percentage done and what the task is doing
+	Progress(pct float64, message string)
+	// Heartbeat tells the scheduler the task is still alive
+	Heartbeat()
+}
+
+// reporterKey is the context key of the Reporter
+type reporterKey struct{}
+
+// ReporterFromContext returns the Reporter of the running task, a Reporter does nothing is
+// returned if the context doesn't belong to a task
+func ReporterFromContext(ctx context.Context) Reporter {
+	if r, ok := ctx.Value(reporterKey{}).(Reporter); ok {
+		return r
+	}
+
+	return nopReporter{}
+}
+
+// nopReporter discards the reports
+type nopReporter struct{}
+
+func (nopReporter) Progress(float64, string) {}
+func (nopReporter) Heartbeat()               {}
+
+// minWatchInterval is the shortest interval the watchers of the scheduler check at, so that a
+// tiny timeout doesn't make a ticker of 0
+const minWatchInterval = time.Millisecond
+
+// watchInterval returns the interval a timeout of d is checked at, half of it
+func watchInterval(d time.Duration) time.Duration {
+	if d/2 < minWatchInterval {
+		return minWatchInterval
+	}
+
+	return d / 2
+}
+
+// WithStallTimeout makes the scheduler report running tasks without a heartbeat for d as
+// stalled, 0 disables the detection
+func WithStallTimeout(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.stallTimeout = d
+	}
+}
+
+// execution is the state of a running task
+type execution struct {
+	sche    *Scheduler
+	task    *task
+	worker  string
+	attempt uint
+	start   time.Time
+
+	mu       sync.Mutex
+	lastBeat time.Time
+	progress float64
+	message  string
+	stalled  bool
+	result   interface{}
+}
+
+// Progress is the Reporter interface implementation
+func (e *execution) Progress(pct float64, message string) {
+	e.mu.Lock()
+	e.progress, e.message = pct, message
+	e.lastBeat = e.sche.clock.Now()
+	e.stalled = false
+	e.mu.Unlock()
+
+	e.sche.emit(Event{Type: EventTaskProgress, TaskID: e.task.id, Progress: pct, Message: message})
+}
+
+// Heartbeat is the Reporter interface implementation
+func (e *execution) Heartbeat() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastBeat = e.sche.clock.Now()
+	e.stalled = false
+}
+
+// checkStall marks the execution stalled if it missed the heartbeat, it returns true only
+// the first time
+func (e *execution) checkStall(now time.Time, timeout time.Duration) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stalled || now.Sub(e.lastBeat) < timeout {
+		return false
+	}
+
+	e.stalled = true
+	return true
+}
+
+// begin records t as running and returns the context carries its Reporter
+func (s *Scheduler) begin(ctx context.Context, t *task, worker string) (context.Context, *execution) {
+	now := s.clock.Now()
+	e := &execution{
+		sche:     s,
+		task:     t,
+		worker:   worker,
+		attempt:  t.attempts + 1,
+		start:    now,
+		lastBeat: now,
+	}
+
+	s.runMu.Lock()
+	s.running[t] = e
+	s.runMu.Unlock()
+
+	return context.WithValue(ctx, reporterKey{}, e), e
+}
+
+// end forgets the execution of t
+func (s *Scheduler) end(t *task) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	delete(s.running, t)
+}
+
+// watchStalls reports the running tasks missed their heartbeats until the scheduler stops
+func (s *Scheduler) watchStalls() {
+	ticker := s.clock.NewTicker(watchInterval(s.stallTimeout))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C():
+			s.runMu.Lock()
+			var stalled []*execution
+			for _, e := range s.running {
+				if e.checkStall(now, s.stallTimeout) {
+					stalled = append(stalled, e)
+				}
+			}
+			s.runMu.Unlock()
+
+			for _, e := range stalled {
+				s.logger.Warn("task stalled", "task", e.task.id, "timeout", s.stallTimeout)
+				s.metrics.AddCounter("tasks_stalled_total", nil, 1)
+				s.emit(Event{Type: EventTaskStalled, TaskID: e.task.id})
+			}
+		case <-s.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	events := make(chan Event, 10)
+	s := New(WithObserver(ObserverFunc(func(e Event) {
+		events <- e
+	})))
+	go s.Start(1)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		ReporterFromContext(ctx).Progress(50, "half way")
+		return nil
+	}).WithID("progress"))
+	s.Wait()
+	s.Stop()
+
+	select {
+	case e := <-events:
+		if e.Type != EventTaskProgress || e.TaskID != "progress" || e.Progress != 50 || e.Message != "half way" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Error("progress event is expected")
+	}
+}
+
+func TestStall(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	events := make(chan Event, 10)
+	s := New(WithClock(clock), WithStallTimeout(time.Minute), WithObserver(ObserverFunc(func(e Event) {
+		events <- e
+	})))
+	go s.Start(1)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}).WithID("stall"))
+
+	// the ticker of the stall detection
+	clock.BlockUntil(1)
+	<-started
+
+	clock.Advance(time.Minute)
+	select {
+	case e := <-events:
+		if e.Type != EventTaskStalled || e.TaskID != "stall" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("stalled event is expected")
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+}
+
+func TestStallTinyTimeout(t *testing.T) {
+	if d := watchInterval(time.Nanosecond); d != minWatchInterval {
+		t.Errorf("interval is expected as %v, actually %v", minWatchInterval, d)
+	}
+
+	s := New(WithStallTimeout(time.Nanosecond))
+	go s.Start(1)
+
+	done := make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(done)
+		return nil
+	}))
+	<-done
+	s.Wait()
+	s.Stop()
+}
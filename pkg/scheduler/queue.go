@@ -2,43 +2,187 @@ package scheduler
 
 import (
 	"container/heap"
+	"context"
+	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrQueueFull is returned when a bounded queue can't accept a new task
+	ErrQueueFull = errors.New("queue is full")
+	// ErrDropped is passed to the catch function of a task evicted from a bounded queue
+	ErrDropped = errors.New("task dropped from full queue")
+)
+
+// OverflowPolicy decides what a bounded queue does when a task is added while it is full
+type OverflowPolicy int
+
+const (
+	// Block waits until there is room in the queue or the context is done
+	Block OverflowPolicy = iota
+	// Reject refuses the new task with ErrQueueFull
+	Reject
+	// DropOldest evicts the task that has been queued for the longest time
+	DropOldest
+	// DropLowestPriority evicts the task that would be dispatched last, the new task
+	// is rejected with ErrQueueFull if it ranks last itself. A queue without a compare
+	// function has no priorities, so it drops the oldest task as DropOldest.
+	DropLowestPriority
 )
 
 // Queue is for storing tasks, supports sorting of tasks, and determines the order of execution of tasks
 type Queue interface {
-	Add(t Task)
+	Add(ctx context.Context, t Task) error
 	Get() Task
+	// TryGet returns the first task accepted in dispatch order without blocking
+	TryGet(accept func(Task) bool) (Task, bool)
 	Done(t Task)
+	// Remove takes t out of the queue, it returns false if t isn't waiting in the queue
+	Remove(t Task) bool
+	// Tasks returns the waiting tasks in dispatch order
+	Tasks() []Task
 	SetCompareFunc(CompareFunc)
 	IsEmpty() bool
 }
 
 // chanQueue is the implementation of Queue use channel
-type chanQueue chan Task
+type chanQueue struct {
+	tasks  chan Task
+	policy OverflowPolicy
+
+	// head is the task received by TryGet but not accepted
+	mu   sync.Mutex
+	head Task
 
-func NewChanQueue(qsize int) Queue {
-	return chanQueue(make(chan Task, qsize))
+	// pending counts the tasks added and not done yet
+	pending int64
+}
+
+// NewChanQueue returns a Queue backed by a channel with qsize buffer, a channel can't be
+// sorted, so DropLowestPriority behaves like DropOldest
+func NewChanQueue(qsize int, policy OverflowPolicy) Queue {
+	return &chanQueue{
+		tasks:  make(chan Task, qsize),
+		policy: policy,
+	}
 }
 
 // Add add a new Task to Queue
-func (q chanQueue) Add(t Task) {
-	q <- t
+func (q *chanQueue) Add(ctx context.Context, t Task) error {
+	atomic.AddInt64(&q.pending, 1)
+
+	select {
+	case q.tasks <- t:
+		return nil
+	default:
+	}
+
+	switch q.policy {
+	case Reject:
+		atomic.AddInt64(&q.pending, -1)
+		return ErrQueueFull
+	case DropOldest, DropLowestPriority:
+		for {
+			select {
+			case q.tasks <- t:
+				return nil
+			case victim := <-q.tasks:
+				atomic.AddInt64(&q.pending, -1)
+				drop(victim)
+			}
+		}
+	}
+
+	select {
+	case q.tasks <- t:
+		return nil
+	case <-ctx.Done():
+		atomic.AddInt64(&q.pending, -1)
+		return ctx.Err()
+	}
 }
 
 // Get return a task
-func (q chanQueue) Get() Task {
-	return <-q
+func (q *chanQueue) Get() Task {
+	q.mu.Lock()
+	if t := q.head; t != nil {
+		q.head = nil
+		q.mu.Unlock()
+		return t
+	}
+	q.mu.Unlock()
+
+	return <-q.tasks
+}
+
+// TryGet returns the task at the head if it's accepted, a channel can only be read in order
+func (q *chanQueue) TryGet(accept func(Task) bool) (Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.head == nil {
+		select {
+		case q.head = <-q.tasks:
+		default:
+			return nil, false
+		}
+	}
+
+	if !accept(q.head) {
+		return nil, false
+	}
+
+	t := q.head
+	q.head = nil
+	return t, true
 }
 
 // Done means that the Task has finished
-func (q chanQueue) Done(t Task) {}
+func (q *chanQueue) Done(t Task) {
+	atomic.AddInt64(&q.pending, -1)
+}
+
+// Tasks returns the task received by TryGet only, the tasks in a channel can't be seen
+func (q *chanQueue) Tasks() []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.head == nil {
+		return nil
+	}
+
+	return []Task{q.head}
+}
+
+// Remove can't take a task out of a channel, a cancelled task is skipped by the worker
+// when it's received
+func (q *chanQueue) Remove(t Task) bool {
+	return false
+}
 
 // IsEmpty tells the user whether the queue is empty
-func (q chanQueue) IsEmpty() bool { return false }
+func (q *chanQueue) IsEmpty() bool {
+	return atomic.LoadInt64(&q.pending) == 0
+}
 
 // SetCompareFunc set the func used for sorting
-func (q chanQueue) SetCompareFunc(CompareFunc) {}
+func (q *chanQueue) SetCompareFunc(CompareFunc) {}
+
+// drop tells an evicted task why it won't run
+func drop(t Task) {
+	if t, ok := t.(*task); ok {
+		t.complete(Outcome{Err: ErrDropped, Reason: ErrDropped})
+	}
+}
+
+// reject tells a task added again while it was running that there is no room for it
+func reject(t Task) {
+	if t, ok := t.(*task); ok {
+		t.complete(Outcome{Err: ErrQueueFull, Attempt: t.attempts, Reason: ErrQueueFull})
+	}
+}
 
 // Type is the real implementation for Queue, it supports sorting and avoid reentrant
 type Type struct {
@@ -47,7 +191,15 @@ type Type struct {
 	running     set
 	dirty       set
 	cond        *sync.Cond
+	notFull     *sync.Cond
 	compareFunc CompareFunc
+
+	capacity int
+	policy   OverflowPolicy
+
+	// order records when each waiting task was pushed, used to find the oldest one
+	order map[t]uint64
+	added uint64
 }
 
 // CompareFunc is the type for function used for sorting
@@ -55,37 +207,66 @@ type CompareFunc func(t1, t2 Task) bool
 
 // NewQueue returns a new Queue
 func NewQueue() Queue {
+	return NewBoundedQueue(0, Block)
+}
+
+// NewBoundedQueue returns a new Queue holds at most capacity waiting tasks, policy decides
+// what to do when it's full. A capacity of 0 means no limit.
+func NewBoundedQueue(capacity int, policy OverflowPolicy) Queue {
+	mu := &sync.Mutex{}
 	q := &Type{
-		queue:   []Task{},
-		running: set{},
-		dirty:   set{},
-		cond:    sync.NewCond(&sync.Mutex{}),
+		queue:    []Task{},
+		running:  set{},
+		dirty:    set{},
+		order:    map[t]uint64{},
+		cond:     sync.NewCond(mu),
+		notFull:  sync.NewCond(mu),
+		capacity: capacity,
+		policy:   policy,
 	}
 
 	return q
 }
 
 // Add add a new Task to Queue
-func (q *Type) Add(t Task) {
+func (q *Type) Add(ctx context.Context, t Task) error {
 	q.cond.L.Lock()
-	defer q.cond.L.Unlock()
 
 	if q.dirty.has(t) {
-		return
+		q.cond.L.Unlock()
+		return nil
 	}
 
-	q.dirty.insert(t)
 	if q.running.has(t) {
-		return
+		q.dirty.insert(t)
+		q.cond.L.Unlock()
+		return nil
 	}
 
-	if q.compareFunc == nil {
-		q.queue = append(q.queue, t)
-	} else {
-		heap.Push(q, t)
+	var victim Task
+	if q.isFull() {
+		var err error
+		if q.policy == Block {
+			err = q.waitNotFull(ctx)
+		} else {
+			victim, err = q.overflow(t)
+		}
+		if err != nil {
+			q.cond.L.Unlock()
+			return err
+		}
 	}
 
+	q.dirty.insert(t)
+	q.push(t)
 	q.cond.Signal()
+	q.cond.L.Unlock()
+
+	if victim != nil {
+		drop(victim)
+	}
+
+	return nil
 }
 
 // Get return a task
@@ -103,26 +284,141 @@ func (q *Type) Get() Task {
 		t = heap.Pop(q).(Task)
 	}
 
+	q.take(t)
+	return t
+}
+
+// TryGet returns the first task accepted in dispatch order without blocking
+func (q *Type) TryGet(accept func(Task) bool) (Task, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.compareFunc == nil {
+		for i, t := range q.queue {
+			if accept(t) {
+				q.queue = append(q.queue[:i], q.queue[i+1:]...)
+				q.take(t)
+				return t, true
+			}
+		}
+
+		return nil, false
+	}
+
+	// pop in order until a task is accepted, then put the skipped ones back
+	var skipped []Task
+	defer func() {
+		for _, t := range skipped {
+			heap.Push(q, t)
+		}
+	}()
+
+	for len(q.queue) > 0 {
+		t := heap.Pop(q).(Task)
+		if accept(t) {
+			q.take(t)
+			return t, true
+		}
+		skipped = append(skipped, t)
+	}
+
+	return nil, false
+}
+
+// take marks t as running, the caller must hold the lock
+func (q *Type) take(t Task) {
 	q.running.insert(t)
 	q.dirty.delete(t)
-
-	return t
+	delete(q.order, t)
+	q.notFull.Signal()
 }
 
-// Done means that the Task has finished
+// Done means that the Task has finished, a task added again while it was running is queued
+// by the policy as if it were added now. It can't wait for room, so Block refuses it as Reject.
 func (q *Type) Done(t Task) {
 	q.cond.L.Lock()
-	defer q.cond.L.Unlock()
 
 	q.running.delete(t)
-	if q.dirty.has(t) {
+	if !q.dirty.has(t) {
+		q.cond.L.Unlock()
+		return
+	}
+
+	var (
+		victim Task
+		err    error
+	)
+	if q.isFull() {
+		victim, err = q.overflow(t)
+	}
+	if err != nil {
+		q.dirty.delete(t)
+		q.cond.L.Unlock()
+		reject(t)
+		return
+	}
+
+	q.push(t)
+	q.cond.Signal()
+	q.cond.L.Unlock()
+
+	if victim != nil {
+		drop(victim)
+	}
+}
+
+// Tasks returns the waiting tasks in dispatch order
+func (q *Type) Tasks() []Task {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	tasks := append([]Task{}, q.queue...)
+	if q.compareFunc != nil {
+		sort.SliceStable(tasks, func(i, j int) bool {
+			if q.compareFunc(tasks[i], tasks[j]) {
+				return true
+			}
+			if q.compareFunc(tasks[j], tasks[i]) {
+				return false
+			}
+			return q.order[tasks[i]] < q.order[tasks[j]]
+		})
+	}
+
+	return tasks
+}
+
+// Remove takes t out of the queue, a running task added again is only forgotten so that
+// it won't run again
+func (q *Type) Remove(t Task) bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if !q.dirty.has(t) {
+		return false
+	}
+
+	if q.running.has(t) {
+		q.dirty.delete(t)
+		return false
+	}
+
+	for i := range q.queue {
+		if q.queue[i] != t {
+			continue
+		}
+
 		if q.compareFunc == nil {
-			q.queue = append(q.queue, t)
+			q.queue = append(q.queue[:i], q.queue[i+1:]...)
 		} else {
-			heap.Push(q, t)
+			heap.Remove(q, i)
 		}
-		q.cond.Signal()
+		q.evict(t)
+		q.notFull.Signal()
+		return true
 	}
+
+	return false
 }
 
 // IsEmpty tells the user whether the queue is empty
@@ -142,6 +438,115 @@ func (q *Type) SetCompareFunc(f CompareFunc) {
 	heap.Init(q)
 }
 
+// push puts t in q.queue, the caller must hold the lock
+func (q *Type) push(t Task) {
+	q.added++
+	q.order[t] = q.added
+
+	if q.compareFunc == nil {
+		q.queue = append(q.queue, t)
+	} else {
+		heap.Push(q, t)
+	}
+}
+
+// isFull reports whether the waiting tasks reach the capacity, the caller must hold the lock
+func (q *Type) isFull() bool {
+	return q.capacity > 0 && len(q.queue) >= q.capacity
+}
+
+// waitNotFull blocks until q has room for a task or ctx is done, the caller must hold the lock
+func (q *Type) waitNotFull(ctx context.Context) error {
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				q.cond.L.Lock()
+				q.notFull.Broadcast()
+				q.cond.L.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+
+	for q.isFull() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		q.notFull.Wait()
+	}
+
+	return nil
+}
+
+// removeOldest removes the task added earliest, the caller must hold the lock
+func (q *Type) removeOldest() Task {
+	oldest := 0
+	for i := range q.queue {
+		if q.order[q.queue[i]] < q.order[q.queue[oldest]] {
+			oldest = i
+		}
+	}
+
+	if q.compareFunc == nil {
+		victim := q.queue[oldest]
+		q.queue = append(q.queue[:oldest], q.queue[oldest+1:]...)
+		return q.evict(victim)
+	}
+
+	return q.evict(heap.Remove(q, oldest).(Task))
+}
+
+// overflow makes room for t in the full queue by a dropping policy, it returns the evicted
+// task, or ErrQueueFull if t is refused. The caller must hold the lock.
+func (q *Type) overflow(t Task) (Task, error) {
+	switch q.policy {
+	case DropOldest:
+		return q.removeOldest(), nil
+	case DropLowestPriority:
+		// an unsorted queue has no lowest priority, so the oldest task is dropped
+		if q.compareFunc == nil {
+			return q.removeOldest(), nil
+		}
+		if victim := q.removeLowest(t); victim != nil {
+			return victim, nil
+		}
+	}
+
+	return nil, ErrQueueFull
+}
+
+// removeLowest removes the task that would be dispatched last if it ranks below t,
+// the caller must hold the lock
+func (q *Type) removeLowest(t Task) Task {
+	if len(q.queue) == 0 {
+		return nil
+	}
+
+	lowest := 0
+	for i := range q.queue {
+		if q.compareFunc(q.queue[lowest], q.queue[i]) {
+			lowest = i
+		}
+	}
+
+	if !q.compareFunc(t, q.queue[lowest]) {
+		return nil
+	}
+
+	return q.evict(heap.Remove(q, lowest).(Task))
+}
+
+// evict forgets the removed task, the caller must hold the lock
+func (q *Type) evict(t Task) Task {
+	q.dirty.delete(t)
+	delete(q.order, t)
+	return t
+}
+
 // empty is the alias for struct{}
 type empty struct{}
 
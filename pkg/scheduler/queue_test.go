@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newPriorityTask(priority int, dropped *[]int) Task {
+	return TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithPriority(priority).(RetryTask).WithCatch(func(err error) {
+		if errors.Is(err, ErrDropped) {
+			*dropped = append(*dropped, priority)
+		}
+	})
+}
+
+func TestBoundedQueueReject(t *testing.T) {
+	var dropped []int
+	q := NewBoundedQueue(2, Reject)
+
+	for i := 1; i <= 2; i++ {
+		if err := q.Add(context.Background(), newPriorityTask(i, &dropped)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Add(context.Background(), newPriorityTask(3, &dropped)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("error is expected as %v, actually %v", ErrQueueFull, err)
+	}
+
+	q.Get()
+	if err := q.Add(context.Background(), newPriorityTask(3, &dropped)); err != nil {
+		t.Errorf("error is expected as nil, actually %v", err)
+	}
+}
+
+func TestBoundedQueueDropOldest(t *testing.T) {
+	var dropped []int
+	q := NewBoundedQueue(2, DropOldest)
+	q.SetCompareFunc(CompareByPriority)
+
+	for _, priority := range []int{2, 1, 3} {
+		if err := q.Add(context.Background(), newPriorityTask(priority, &dropped)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(dropped) != 1 || dropped[0] != 2 {
+		t.Errorf("dropped is expected as [2], actually %v", dropped)
+	}
+
+	if p := q.Get().(*task).priority; p != 1 {
+		t.Errorf("priority is expected as %d, actually %d", 1, p)
+	}
+}
+
+func TestBoundedQueueDropLowestPriority(t *testing.T) {
+	var dropped []int
+	q := NewBoundedQueue(2, DropLowestPriority)
+	q.SetCompareFunc(CompareByPriority)
+
+	for _, priority := range []int{2, 3, 1} {
+		if err := q.Add(context.Background(), newPriorityTask(priority, &dropped)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(dropped) != 1 || dropped[0] != 3 {
+		t.Errorf("dropped is expected as [3], actually %v", dropped)
+	}
+
+	if err := q.Add(context.Background(), newPriorityTask(4, &dropped)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("error is expected as %v, actually %v", ErrQueueFull, err)
+	}
+}
+
+func TestBoundedQueueDropLowestUnsorted(t *testing.T) {
+	var dropped []int
+	q := NewBoundedQueue(2, DropLowestPriority)
+
+	for _, priority := range []int{2, 3, 1} {
+		if err := q.Add(context.Background(), newPriorityTask(priority, &dropped)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(dropped) != 1 || dropped[0] != 2 {
+		t.Errorf("dropped is expected as [2], actually %v", dropped)
+	}
+}
+
+func TestBoundedQueueDoneFull(t *testing.T) {
+	var rejected []error
+	q := NewBoundedQueue(1, Reject)
+
+	running := TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithCatch(func(err error) {
+		rejected = append(rejected, err)
+	})
+	if err := q.Add(context.Background(), running); err != nil {
+		t.Fatal(err)
+	}
+	q.Get()
+
+	// the running task is added again, then the queue is filled before it's done
+	if err := q.Add(context.Background(), running); err != nil {
+		t.Fatal(err)
+	}
+	var dropped []int
+	if err := q.Add(context.Background(), newPriorityTask(1, &dropped)); err != nil {
+		t.Fatal(err)
+	}
+
+	q.Done(running)
+	if n := len(q.Tasks()); n != 1 {
+		t.Errorf("waiting tasks are expected as 1, actually %d", n)
+	}
+	if len(rejected) != 1 || !errors.Is(rejected[0], ErrQueueFull) {
+		t.Errorf("rejected is expected as [%v], actually %v", ErrQueueFull, rejected)
+	}
+}
+
+func TestBoundedQueueBlock(t *testing.T) {
+	var dropped []int
+	q := NewBoundedQueue(1, Block)
+	if err := q.Add(context.Background(), newPriorityTask(1, &dropped)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Add(ctx, newPriorityTask(2, &dropped)); !errors.Is(err, context.Canceled) {
+		t.Errorf("error is expected as %v, actually %v", context.Canceled, err)
+	}
+
+	added := make(chan error)
+	go func() {
+		added <- q.Add(context.Background(), newPriorityTask(3, &dropped))
+	}()
+
+	q.Get()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Errorf("error is expected as nil, actually %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked add is expected to return after Get")
+	}
+}
+
+func TestChanQueue(t *testing.T) {
+	var dropped []int
+	q := NewChanQueue(1, Reject)
+	if !q.IsEmpty() {
+		t.Error("new queue is expected to be empty")
+	}
+
+	task := newPriorityTask(1, &dropped)
+	if err := q.Add(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Add(context.Background(), newPriorityTask(2, &dropped)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("error is expected as %v, actually %v", ErrQueueFull, err)
+	}
+
+	q.Done(q.Get())
+	if !q.IsEmpty() {
+		t.Error("queue is expected to be empty after the task is done")
+	}
+}
@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrExceedsCapacity is returned when a task requests more resources than the scheduler has
+var ErrExceedsCapacity = errors.New("task requests more resources than the capacity")
+
+// defaultBackfillLimit is the number of times a task can be overtaken by smaller ones
+// before the scheduler keeps the released resources for it
+const defaultBackfillLimit = 16
+
+// Resources is an amount of resources, CPU is in milli units and Memory is in bytes, Custom
+// holds the resources defined by the user such as "gpu"
+type Resources struct {
+	CPU    int64            `json:"cpu,omitempty"`
+	Memory int64            `json:"memory,omitempty"`
+	Custom map[string]int64 `json:"custom,omitempty"`
+}
+
+// IsZero reports whether r requests nothing
+func (r Resources) IsZero() bool {
+	if r.CPU != 0 || r.Memory != 0 {
+		return false
+	}
+
+	for _, v := range r.Custom {
+		if v != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Fits reports whether r fits in capacity, a zero amount in capacity means unlimited
+func (r Resources) Fits(capacity Resources) bool {
+	if !fits(r.CPU, capacity.CPU) || !fits(r.Memory, capacity.Memory) {
+		return false
+	}
+
+	for name, v := range r.Custom {
+		if !fits(v, capacity.Custom[name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fits compares an amount of a resource, a capacity of 0 means unlimited
+func fits(request, capacity int64) bool {
+	return capacity == 0 || request <= capacity
+}
+
+// add returns r plus o if sign is 1, r minus o if sign is -1
+func (r Resources) add(o Resources, sign int64) Resources {
+	result := Resources{
+		CPU:    r.CPU + sign*o.CPU,
+		Memory: r.Memory + sign*o.Memory,
+		Custom: map[string]int64{},
+	}
+
+	for name, v := range r.Custom {
+		result.Custom[name] = v
+	}
+	for name, v := range o.Custom {
+		result.Custom[name] += sign * v
+	}
+
+	return result
+}
+
+// WithCapacity sets the resources the tasks running at the same time can use, a zero amount
+// means unlimited
+func WithCapacity(c Resources) Option {
+	return func(s *Scheduler) {
+		s.capacity = c
+	}
+}
+
+// WithBackfillLimit sets how many times a task waiting for resources can be overtaken by
+// smaller tasks before the scheduler stops starting tasks behind it
+func WithBackfillLimit(n int) Option {
+	return func(s *Scheduler) {
+		s.backfillLimit = n
+	}
+}
+
+// resourcePool tracks the resources in use
+type resourcePool struct {
+	mu   sync.Mutex
+	used Resources
+}
+
+// Capacity returns the resources the scheduler can use
+func (s *Scheduler) Capacity() Resources {
+	return s.capacity
+}
+
+// Usage returns the resources used by the running tasks
+func (s *Scheduler) Usage() Resources {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	return s.pool.used.add(Resources{}, 1)
+}
+
+// reserve takes the resources of r if they are available
+func (s *Scheduler) reserve(r Resources) bool {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	if !r.add(s.pool.used, 1).Fits(s.capacity) {
+		return false
+	}
+
+	s.pool.used = s.pool.used.add(r, 1)
+	s.reportUsage()
+	return true
+}
+
+// release gives the resources of r back
+func (s *Scheduler) release(r Resources) {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	s.pool.used = s.pool.used.add(r, -1)
+	s.reportUsage()
+
+	// the workers parked for resources have a look again
+	if q, ok := s.queue.(*stealingQueue); ok && !r.IsZero() {
+		q.wakeAll()
+	}
+}
+
+// reportUsage exports the resources in use, the caller must hold the lock
+func (s *Scheduler) reportUsage() {
+	s.metrics.SetGauge("resources_used", map[string]string{"resource": "cpu"}, float64(s.pool.used.CPU))
+	s.metrics.SetGauge("resources_used", map[string]string{"resource": "memory"}, float64(s.pool.used.Memory))
+	for name, v := range s.pool.used.Custom {
+		s.metrics.SetGauge("resources_used", map[string]string{"resource": name}, float64(v))
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExceedsCapacity(t *testing.T) {
+	s := New(WithCapacity(Resources{CPU: 1000}))
+
+	err := s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithResources(Resources{CPU: 2000}))
+	if !errors.Is(err, ErrExceedsCapacity) {
+		t.Errorf("error is expected as %v, actually %v", ErrExceedsCapacity, err)
+	}
+}
+
+func TestResourceBackfill(t *testing.T) {
+	s := New(WithCapacity(Resources{CPU: 1000, Custom: map[string]int64{"gpu": 1}}))
+	go s.Start(3)
+
+	running, release := make(chan string, 3), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "big"
+		<-release
+		return nil
+	}).WithResources(Resources{CPU: 600, Custom: map[string]int64{"gpu": 1}}))
+
+	if name := <-running; name != "big" {
+		t.Fatalf("running is expected as big, actually %s", name)
+	}
+
+	if used := s.Usage(); used.CPU != 600 || used.Custom["gpu"] != 1 {
+		t.Errorf("usage is expected as 600 cpu and 1 gpu, actually %+v", used)
+	}
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "blocked"
+		return nil
+	}).WithResources(Resources{CPU: 600}))
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "small"
+		return nil
+	}).WithResources(Resources{CPU: 300}))
+
+	select {
+	case name := <-running:
+		if name != "small" {
+			t.Errorf("running is expected as small, actually %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("small task is expected to overtake the blocked one")
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	if name := <-running; name != "blocked" {
+		t.Errorf("running is expected as blocked, actually %s", name)
+	}
+
+	if used := s.Usage(); used.CPU != 0 || used.Custom["gpu"] != 0 {
+		t.Errorf("usage is expected as zero, actually %+v", used)
+	}
+}
+
+func TestResourceNoBackfill(t *testing.T) {
+	s := New(WithCapacity(Resources{CPU: 1000, Memory: 1}), WithBackfillLimit(0))
+	go s.Start(3)
+
+	running, release := make(chan string, 3), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "big"
+		<-release
+		return nil
+	}).WithResources(Resources{CPU: 600}))
+	<-running
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "blocked"
+		return nil
+	}).WithResources(Resources{CPU: 600, Memory: 1}))
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		running <- "small"
+		return nil
+	}).WithResources(Resources{CPU: 400, Memory: 1}))
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	for _, expected := range []string{"blocked", "small"} {
+		if name := <-running; name != expected {
+			t.Errorf("running is expected as %s, actually %s", expected, name)
+		}
+	}
+}
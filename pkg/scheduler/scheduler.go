@@ -3,8 +3,12 @@ package scheduler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -13,42 +17,233 @@ var (
 
 // Scheduler caches tasks and schedule tasks to work.
 type Scheduler struct {
+	// delayed counts the tasks kept out of the queue for a while, such as the ones held by
+	// circuit breakers
+	delayed int64
+	// seq is used to generate the ids of tasks
+	seq uint64
+	// workerSeq is used to generate the ids of workers
+	workerSeq uint64
+	deadlines deadlineStats
+	// retiring counts the workers to stop once they are idle
+	retiring int64
+	paused   int32
+
 	queue   Queue
-	workers chan chan Task
+	workers chan *goroutineWorker
+	groups  []workerGroup
+	// kick wakes the dispatcher up when tasks are added
+	kick chan struct{}
+
+	workerFactory WorkerFactory
+	wsize         int
+	name          string
+	middleware    []Middleware
+	logger        Logger
+	clock         Clock
+	observers     []Observer
+	metrics       Metrics
+
+	// stopChs stop the unlabeled workers, one for each
+	sizeMu  sync.Mutex
+	stopChs []chan struct{}
+
+	breakerMu      sync.Mutex
+	breakers       map[string]*Breaker
+	breakerConfigs map[string]BreakerConfig
+
+	taskMu sync.Mutex
+	tasks  map[string]*task
+
+	runMu        sync.Mutex
+	running      map[*task]*execution
+	stallTimeout time.Duration
+
+	statsMu sync.Mutex
+	avgRun  time.Duration
+
+	calendar  Calendar
+	wakeMu    sync.Mutex
+	wakeTimer Timer
+	wakeTime  time.Time
+
+	deadlineAdmission bool
+	missPolicy        MissPolicy
+	// edf is set when the queue is sorted by deadline
+	edf bool
+
+	// shedThreshold is the queue latency over which the scheduler sheds tasks
+	shedThreshold time.Duration
+
+	checkpoints CheckpointStore
+	faults      *FaultInjector
+	autoscale   *autoscaler
+	registry    *Registry
+	// volatile keeps the checkpoints of the tasks with generated ids
+	volatile CheckpointStore
+
+	capacity      Resources
+	backfillLimit int
+	pool          resourcePool
 
 	shutdown chan struct{}
 	stop     sync.Once
 }
 
 // New a goroutine Scheduler.
-func New() *Scheduler {
-	return &Scheduler{
-		queue:    NewQueue(),
-		workers:  make(chan chan Task),
-		shutdown: make(chan struct{}),
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		queue:         NewQueue(),
+		workers:       make(chan *goroutineWorker),
+		kick:          make(chan struct{}, 1),
+		workerFactory: NewGoroutineWorker,
+		name:          "default",
+		logger:        defaultLogger,
+		clock:         RealClock(),
+		metrics:       nopMetrics{},
+		checkpoints:   NewMemoryCheckpointStore(),
+		volatile:      NewMemoryCheckpointStore(),
+		registry:      NewRegistry(),
+		shutdown:      make(chan struct{}),
+
+		breakers:       map[string]*Breaker{},
+		breakerConfigs: map[string]BreakerConfig{},
+		tasks:          map[string]*task{},
+		running:        map[*task]*execution{},
+		backfillLimit:  defaultBackfillLimit,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.faults = newFaultInjector(s)
+
+	return s
 }
 
-// Starts the scheduling.
+// Starts the scheduling, wsize workers are started, 0 means the number set by WithWorkers
+// or the number of CPUs.
 func (s *Scheduler) Start(wsize int) {
+	if wsize == 0 {
+		wsize = s.wsize
+	}
 	if wsize == 0 {
 		wsize = runtime.NumCPU()
 	}
-	for i := 0; i < wsize; i++ {
-		s.startWorker(s.shutdown)
+	s.Resize(wsize)
+	for _, g := range s.groups {
+		for i := 0; i < g.size; i++ {
+			go NewLabeledWorker(s, s.shutdown, g.labels).Work()
+		}
+	}
+
+	if s.stallTimeout > 0 {
+		go s.watchStalls()
+	}
+	if s.shedThreshold > 0 {
+		go s.watchLoad()
+	}
+	if s.autoscale != nil {
+		go s.watchScale()
 	}
 
+	if _, ok := s.queue.(*stealingQueue); ok {
+		// the workers pull tasks by themselves
+		<-s.shutdown
+		return
+	}
+
+	var idle []*goroutineWorker
 	for {
+		if atomic.LoadInt64(&s.retiring) > 0 {
+			idle = s.retire(idle)
+		}
+
+		for len(idle) > 0 {
+			t, i, ok := s.next(idle)
+			if !ok {
+				break
+			}
+
+			idle[i].task <- t
+			idle = append(idle[:i], idle[i+1:]...)
+		}
+
 		select {
 		case worker := <-s.workers:
-			task := s.queue.Get()
-			worker <- task
+			idle = append(idle, worker)
+		case <-s.kick:
 		case <-s.shutdown:
 			return
 		}
 	}
 }
 
+// next takes the first task in dispatch order matches an idle worker and whose resources
+// are available, it returns the index of the chosen worker.
+func (s *Scheduler) next(idle []*goroutineWorker) (Task, int, bool) {
+	worker := -1
+	t, ok := s.queue.TryGet(s.acceptor(func(t *task) bool {
+		worker = pick(idle, t)
+		return worker >= 0
+	}))
+
+	return t, worker, ok
+}
+
+// acceptor returns the function decides whether a task is dispatched during one scan of the
+// queue, match tells whether a worker can take it. Smaller tasks may overtake a task waiting
+// for resources, until it has been overtaken backfillLimit times, then the tasks behind it
+// wait for the resources to be released for it.
+func (s *Scheduler) acceptor(match func(t *task) bool) func(Task) bool {
+	var blocker *task
+	return func(t Task) bool {
+		realTask := t.(*task)
+		if s.Paused() || (blocker != nil && atomic.LoadInt64(&blocker.skips) >= int64(s.backfillLimit)) {
+			return false
+		}
+
+		if !s.eligible(realTask) {
+			return false
+		}
+
+		if !match(realTask) {
+			return false
+		}
+
+		if !s.reserve(realTask.resources) {
+			if blocker == nil {
+				blocker = realTask
+			}
+			return false
+		}
+
+		if blocker != nil {
+			atomic.AddInt64(&blocker.skips, 1)
+		}
+		atomic.StoreInt64(&realTask.skips, 0)
+		return true
+	}
+}
+
+// enqueue adds t to the queue and wakes the dispatcher up
+func (s *Scheduler) enqueue(ctx context.Context, t Task) error {
+	if realTask, ok := t.(*task); ok {
+		atomic.StoreInt64(&realTask.queuedAt, s.clock.Now().UnixNano())
+	}
+
+	if err := s.queue.Add(ctx, t); err != nil {
+		return err
+	}
+
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
 // isShutdown returns whether the schduler has shutdown
 func (s *Scheduler) isShutdown() bool {
 	select {
@@ -77,22 +272,26 @@ func (s *Scheduler) SortByDeadline() error {
 	}
 
 	s.queue.SetCompareFunc(CompareByDeadline)
+	s.edf = true
 	return nil
 }
 
-// Schedule push a task on queue.
+// ScheduleWithCtx push a task on queue, ctx is used by the task and bounds the wait for
+// a full queue with Block policy.
 func (s *Scheduler) ScheduleWithCtx(ctx context.Context, t Task) error {
 	if s.isShutdown() {
 		return errSchedulerStop
 	}
 
 	task := t.SetContext(ctx).BindScheduler(s)
+	if err := s.admit(task); err != nil {
+		return err
+	}
 
-	s.queue.Add(task)
-	return nil
+	return s.submit(ctx, task)
 }
 
-// Schedule push a task on queue.
+// Schedule push a task on queue, it returns ErrQueueFull if the queue is saturated.
 func (s *Scheduler) Schedule(t Task) error {
 	if s.isShutdown() {
 		return errSchedulerStop
@@ -106,7 +305,66 @@ func (s *Scheduler) Schedule(t Task) error {
 		}
 	}
 
-	s.queue.Add(t)
+	if err := s.admit(t); err != nil {
+		return err
+	}
+
+	return s.submit(context.Background(), t)
+}
+
+// submit enqueues a newly scheduled task, it's cancellable by id once it's accepted
+func (s *Scheduler) submit(ctx context.Context, t Task) error {
+	if err := s.track(t); err != nil {
+		return err
+	}
+	if err := s.enqueue(ctx, t); err != nil {
+		if t, ok := t.(*task); ok {
+			s.untrack(t)
+		}
+		return err
+	}
+
+	if t, ok := t.(*task); ok {
+		s.admittedDeadline(t)
+		s.watchDeadline(t)
+		s.watchExpiry(t)
+	}
+
+	return nil
+}
+
+// admit checks whether t can ever run on the scheduler
+func (s *Scheduler) admit(t Task) error {
+	realTask, ok := t.(*task)
+	if !ok {
+		return nil
+	}
+
+	if !realTask.resources.Fits(s.capacity) {
+		return ErrExceedsCapacity
+	}
+
+	for _, c := range []Calendar{s.calendar, realTask.calendar} {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+		}
+	}
+	if _, ok := nextEligible(s.clock.Now(), s.calendar, realTask.calendar); !ok {
+		s.logger.Warn("task never allowed by the calendars", "task", realTask.id)
+		return fmt.Errorf("%w: the calendars never allow it", ErrUnschedulable)
+	}
+
+	if err := s.admitDeadline(realTask); err != nil {
+		s.logger.Warn("task deadline can't be met", "task", realTask.id, "deadline", realTask.deadline)
+		return err
+	}
+
+	if !s.placeable(realTask.selector) {
+		s.logger.Warn("task unschedulable", "task", realTask.id)
+		s.emit(Event{Type: EventTaskUnschedulable, TaskID: realTask.id, Err: ErrUnschedulable})
+		return ErrUnschedulable
+	}
+
 	return nil
 }
 
@@ -114,11 +372,23 @@ func (s *Scheduler) Schedule(t Task) error {
 func (s *Scheduler) Stop() {
 	s.stop.Do(func() {
 		close(s.shutdown)
+		s.stopWorkers()
 	})
 }
 
 // Wait waits for all task finished
 func (s *Scheduler) Wait() {
-	for !s.queue.IsEmpty() {
+	for !s.queue.IsEmpty() || atomic.LoadInt64(&s.delayed) != 0 {
 	}
 }
+
+// nextID returns an id for a task without one, it's prefixed so that it never collides with
+// the numeric ids given by the callers, such as the ids of the task rows
+func (s *Scheduler) nextID() string {
+	return "task-" + strconv.FormatUint(atomic.AddUint64(&s.seq, 1), 10)
+}
+
+// delay counts the tasks kept out of the queue for a while
+func (s *Scheduler) delay(n int64) {
+	atomic.AddInt64(&s.delayed, n)
+}
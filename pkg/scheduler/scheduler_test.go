@@ -3,19 +3,20 @@ package scheduler
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestScheduler(t *testing.T) {
 	taskNum := 10
-	counter := 0
+	var counter int32
 	s := New()
 	go s.Start(2)
 
 	for i := 0; i < taskNum; i++ {
 		s.Schedule(TaskFunc(func(ctx context.Context) error {
-			counter++
+			atomic.AddInt32(&counter, 1)
 			return nil
 		}))
 	}
@@ -23,20 +24,20 @@ func TestScheduler(t *testing.T) {
 	s.Wait()
 	s.Stop()
 
-	if counter != taskNum {
-		t.Errorf("counter is expected as %d, actually %d", taskNum, counter)
+	if n := atomic.LoadInt32(&counter); n != int32(taskNum) {
+		t.Errorf("counter is expected as %d, actually %d", taskNum, n)
 	}
 }
 
 func TestTaskCrash(t *testing.T) {
 	taskNum := 10
-	counter := 0
+	var counter int32
 	s := New()
 	go s.Start(2)
 
 	for i := 0; i < taskNum+2; i++ {
 		s.Schedule(TaskFunc(func(ctx context.Context) error {
-			counter++
+			atomic.AddInt32(&counter, 1)
 			panic("panic")
 		}))
 	}
@@ -44,33 +45,29 @@ func TestTaskCrash(t *testing.T) {
 	s.Wait()
 	s.Stop()
 
-	if counter != taskNum+2 {
-		t.Errorf("counter is expected as %d, actually %d", taskNum+2, counter)
+	if n := atomic.LoadInt32(&counter); n != int32(taskNum+2) {
+		t.Errorf("counter is expected as %d, actually %d", taskNum+2, n)
 	}
 }
 
 func TestCancel(t *testing.T) {
 	counter := 0
-	s := New()
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock))
 	go s.Start(2)
 
-	f := func(ctx context.Context) error {
-		time.Sleep(2000)
-		return nil
-	}
-
-	for i := 0; i < 2; i++ {
-		s.Schedule(TaskFunc(f))
-	}
-
 	s.Schedule(TaskFunc(func(ctx context.Context) error {
 		select {
-		case <-time.After(1000):
+		case <-clock.After(2 * time.Second):
 			counter++
 		case <-ctx.Done():
 		}
 		return nil
-	}).WithTimeout(1000))
+	}).WithTimeout(time.Second))
+
+	// the timeout timer and the timer of the task
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
 
 	s.Wait()
 	s.Stop()
@@ -80,14 +77,42 @@ func TestCancel(t *testing.T) {
 	}
 }
 
+func TestTimeoutBeforeStart(t *testing.T) {
+	counter := 0
+	var caught error
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock))
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		counter++
+		return nil
+	}).WithTimeout(time.Second).(RetryTask).WithCatch(func(err error) {
+		caught = err
+	}))
+
+	clock.Advance(2 * time.Second)
+	go s.Start(1)
+
+	s.Wait()
+	s.Stop()
+
+	if counter != 0 {
+		t.Errorf("counter is expected as %d, actually %d", 0, counter)
+	}
+
+	if !errors.Is(caught, context.DeadlineExceeded) {
+		t.Errorf("error is expected as %v, actually %v", context.DeadlineExceeded, caught)
+	}
+}
+
 func TestRetry(t *testing.T) {
 	taskNum := 10
-	counter := 0
+	var counter int32
 	retryTimes := uint(10)
 	s := New()
 	go s.Start(2)
 	f := func(ctx context.Context) error {
-		counter++
+		atomic.AddInt32(&counter, 1)
 		return errors.New("test retry")
 	}
 
@@ -98,8 +123,8 @@ func TestRetry(t *testing.T) {
 	s.Wait()
 	s.Stop()
 
-	if counter != taskNum*(int(retryTimes)+1) {
-		t.Errorf("counter is expected as %d, actually %d", taskNum*(int(retryTimes)+1), counter)
+	if n := atomic.LoadInt32(&counter); n != int32(taskNum*(int(retryTimes)+1)) {
+		t.Errorf("counter is expected as %d, actually %d", taskNum*(int(retryTimes)+1), n)
 	}
 }
 
@@ -192,16 +217,16 @@ func TestFIFO(t *testing.T) {
 
 func TestStartCallback(t *testing.T) {
 	taskNum := 10
-	counter := 0
+	var counter int32
 	s := New()
 	go s.Start(2)
 
 	for i := 0; i < taskNum; i++ {
 		s.Schedule(TaskFunc(func(ctx context.Context) error {
-			counter++
+			atomic.AddInt32(&counter, 1)
 			return nil
 		}).AddStartCallback(func(ctx context.Context) error {
-			counter++
+			atomic.AddInt32(&counter, 1)
 			return nil
 		}))
 	}
@@ -209,23 +234,23 @@ func TestStartCallback(t *testing.T) {
 	s.Wait()
 	s.Stop()
 
-	if counter != taskNum*2 {
-		t.Errorf("counter is expected as %d, actually %d", taskNum, counter)
+	if n := atomic.LoadInt32(&counter); n != int32(taskNum*2) {
+		t.Errorf("counter is expected as %d, actually %d", taskNum, n)
 	}
 }
 
 func TestFinishedCallback(t *testing.T) {
 	taskNum := 10
-	counter := 0
+	var counter int32
 	s := New()
 	go s.Start(2)
 
 	for i := 0; i < taskNum; i++ {
 		s.Schedule(TaskFunc(func(ctx context.Context) error {
-			counter++
+			atomic.AddInt32(&counter, 1)
 			return nil
 		}).AddFinishedCallback(func(ctx context.Context) error {
-			counter++
+			atomic.AddInt32(&counter, 1)
 			return nil
 		}))
 	}
@@ -233,7 +258,7 @@ func TestFinishedCallback(t *testing.T) {
 	s.Wait()
 	s.Stop()
 
-	if counter != taskNum*2 {
-		t.Errorf("counter is expected as %d, actually %d", taskNum, counter)
+	if n := atomic.LoadInt32(&counter); n != int32(taskNum*2) {
+		t.Errorf("counter is expected as %d, actually %d", taskNum, n)
 	}
 }
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrExpired is the error of a task not started within its time-to-live
+	ErrExpired = errors.New("task expired before it started")
+	// ErrShed is the error of a task shed from an overloaded queue
+	ErrShed = errors.New("task shed from overloaded queue")
+)
+
+// TTLTask is a task only worth running if it starts within a time-to-live
+type TTLTask interface {
+	Task
+	WithTTL(ttl time.Duration) Task
+}
+
+// WithLoadShedding makes the scheduler shed the lowest-priority waiting tasks once the oldest
+// waiting task has waited longer than threshold, the ones would be dispatched last go first
+// among the same priority. It sheds until the rest can be drained within threshold at the
+// average run time, at least one task each time it checks. Only the tasks could be
+// dispatched now count, the ones deferred by the calendars or waiting for resources in use
+// are neither counted nor shed.
+func WithLoadShedding(threshold time.Duration) Option {
+	return func(s *Scheduler) {
+		s.shedThreshold = threshold
+	}
+}
+
+// watchExpiry expires t if it hasn't started when its time-to-live is over
+func (s *Scheduler) watchExpiry(t *task) {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	if t.expireAt.IsZero() || t.expireTimer != nil {
+		return
+	}
+
+	t.expireTimer = s.clock.AfterFunc(t.expireAt.Sub(s.clock.Now()), func() {
+		if s.queue.Remove(t) {
+			s.expire(t)
+		}
+	})
+}
+
+// started stops the time-to-live of t, which only counts until the task first starts
+func (s *Scheduler) started(t *task) {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	t.expireAt = time.Time{}
+	if t.expireTimer != nil {
+		t.expireTimer.Stop()
+		t.expireTimer = nil
+	}
+}
+
+// expired reports whether t is over its time-to-live
+func (s *Scheduler) expired(t *task) bool {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	return !t.expireAt.IsZero() && !s.clock.Now().Before(t.expireAt)
+}
+
+// expire fails t with ErrExpired
+func (s *Scheduler) expire(t *task) {
+	s.logger.Warn("task expired", "task", t.id)
+	s.metrics.AddCounter("tasks_expired_total", map[string]string{"queue": s.name}, 1)
+	s.emit(Event{Type: EventTaskExpired, TaskID: t.id, Err: ErrExpired})
+	t.complete(Outcome{Err: ErrExpired, Reason: ErrExpired})
+}
+
+// dispatchable returns the waiting tasks could be dispatched now if a worker were free, the
+// ones the calendars don't allow yet or whose resources are in use are left out
+func (s *Scheduler) dispatchable(tasks []Task) []Task {
+	now := s.clock.Now()
+	used := s.Usage()
+
+	var ready []Task
+	for _, t := range tasks {
+		realTask, ok := t.(*task)
+		if !ok {
+			ready = append(ready, t)
+			continue
+		}
+
+		if !allowed(now, s.calendar, realTask.calendar) || !realTask.resources.add(used, 1).Fits(s.capacity) {
+			continue
+		}
+		ready = append(ready, t)
+	}
+
+	return ready
+}
+
+// latency returns how long the oldest waiting task has waited
+func (s *Scheduler) latency(tasks []Task) time.Duration {
+	now := s.clock.Now()
+
+	var oldest time.Duration
+	for _, t := range tasks {
+		realTask, ok := t.(*task)
+		if !ok {
+			continue
+		}
+
+		queuedAt := atomic.LoadInt64(&realTask.queuedAt)
+		if queuedAt == 0 {
+			continue
+		}
+
+		if waited := now.Sub(time.Unix(0, queuedAt)); waited > oldest {
+			oldest = waited
+		}
+	}
+
+	return oldest
+}
+
+// shed drops the lowest-priority waiting tasks if the queue latency is over the threshold, it
+// returns the number of tasks shed
+func (s *Scheduler) shed() int {
+	tasks := s.dispatchable(s.queue.Tasks())
+	if s.latency(tasks) <= s.shedThreshold {
+		return 0
+	}
+
+	// a larger priority value runs later, as CompareByPriority sorts
+	sort.SliceStable(tasks, func(i, j int) bool {
+		t1, ok1 := tasks[i].(*task)
+		t2, ok2 := tasks[j].(*task)
+		return ok1 && ok2 && t1.priority < t2.priority
+	})
+
+	workers := s.Workers()
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// the number of tasks can be drained within the threshold
+	keep := len(tasks) - 1
+	if avg := s.averageRun(); avg > 0 {
+		if n := int(s.shedThreshold/avg) * workers; n < keep {
+			keep = n
+		}
+	}
+
+	shed := 0
+	for i := len(tasks) - 1; i >= keep && i >= 0; i-- {
+		t, ok := tasks[i].(*task)
+		if !ok || !s.queue.Remove(t) {
+			continue
+		}
+
+		shed++
+		s.logger.Warn("task shed", "task", t.id, "threshold", s.shedThreshold)
+		s.metrics.AddCounter("tasks_shed_total", map[string]string{"queue": s.name}, 1)
+		s.emit(Event{Type: EventTaskShed, TaskID: t.id, Err: ErrShed})
+		t.complete(Outcome{Err: ErrShed, Attempt: t.attempts, Reason: ErrShed})
+	}
+
+	return shed
+}
+
+// watchLoad sheds tasks from the overloaded queue until the scheduler stops
+func (s *Scheduler) watchLoad() {
+	ticker := s.clock.NewTicker(watchInterval(s.shedThreshold))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.shed()
+		case <-s.shutdown:
+			return
+		}
+	}
+}
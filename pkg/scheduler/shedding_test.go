@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock))
+	go s.Start(1)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}).WithTTL(time.Second))
+	<-started
+
+	ran := false
+	outcomes := make(chan Outcome, 1)
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		ran = true
+		return nil
+	}).WithTTL(time.Second).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+
+	// the timer of the running task is stopped
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	if o := <-outcomes; o.Reason != ErrExpired || o.Attempt != 0 {
+		t.Errorf("task is expected to expire, actually %+v", o)
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	if ran {
+		t.Error("expired task isn't expected to run")
+	}
+}
+
+func TestLoadShedding(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := New(WithClock(clock), WithLoadShedding(time.Second))
+	go s.Start(1)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+
+	reasons := make(chan error, 3)
+	for _, p := range []int{3, 1, 2} {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			return nil
+		}).WithID(string(rune('0' + p))).(PriorityTask).WithPriority(p).(OutcomeTask).OnOutcome(func(ctx context.Context, o Outcome) {
+			reasons <- o.Reason
+		}))
+	}
+
+	if n := s.shed(); n != 0 {
+		t.Errorf("tasks aren't expected to be shed below the threshold, actually %d", n)
+	}
+
+	// the checks run every half of the threshold, each sheds one task without the run times
+	clock.BlockUntil(1)
+	for i, id := range []string{"3", "2"} {
+		if i == 0 {
+			clock.Advance(1200 * time.Millisecond)
+		} else {
+			clock.Advance(600 * time.Millisecond)
+		}
+
+		if <-reasons != ErrShed {
+			t.Errorf("task %s is expected to be shed", id)
+		}
+		if _, _, err := s.Estimate(id); err != ErrTaskNotFound {
+			t.Errorf("task %s is expected to be shed first, actually %v", id, err)
+		}
+	}
+
+	close(release)
+	if reason := <-reasons; reason != nil {
+		t.Errorf("the highest-priority task is expected to run, actually %v", reason)
+	}
+	s.Wait()
+	s.Stop()
+}
+
+func TestLoadSheddingSkipsDeferred(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC))
+	// the scheduler isn't started, so the tasks stay in the queue
+	s := New(WithClock(clock), WithLoadShedding(time.Second))
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithID("deferred").(CalendarTask).WithCalendar(Calendar{Allowed: []Window{{Start: "12:00", End: "13:00"}}}))
+	clock.Advance(time.Hour)
+
+	if n := s.shed(); n != 0 {
+		t.Errorf("a task deferred by its calendar isn't expected to be shed, actually %d shed", n)
+	}
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).WithID("ready"))
+	clock.Advance(time.Hour)
+
+	if n := s.shed(); n != 1 {
+		t.Errorf("the task could run is expected to be shed, actually %d shed", n)
+	}
+	if _, _, err := s.Estimate("ready"); err != ErrTaskNotFound {
+		t.Errorf("task ready is expected to be shed, actually %v", err)
+	}
+	if _, _, err := s.Estimate("deferred"); err != nil {
+		t.Errorf("task deferred is expected to be kept, actually %v", err)
+	}
+}
+
+func TestLoadSheddingTinyThreshold(t *testing.T) {
+	s := New(WithLoadShedding(time.Nanosecond))
+	go s.Start(1)
+
+	// the task may be shed before it runs, either way it has an outcome
+	outcomes := make(chan Outcome, 1)
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		return nil
+	}).OnOutcome(func(ctx context.Context, o Outcome) {
+		outcomes <- o
+	}))
+	<-outcomes
+	s.Wait()
+	s.Stop()
+}
@@ -0,0 +1,332 @@
+package scheduler
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Job is a task of a simulated workload, the times are counted from the start of the
+// simulation
+type Job struct {
+	ID       string
+	Arrival  time.Duration
+	Duration time.Duration
+	Priority int
+	// Deadline is how long after the arrival the job must finish by, 0 means no deadline
+	Deadline time.Duration
+	// FailureRate is the chance each attempt fails
+	FailureRate float64
+	Retries     uint
+}
+
+// Workload is the jobs of a simulation
+type Workload []Job
+
+// WorkloadConfig describes a synthetic workload
+type WorkloadConfig struct {
+	Jobs int `json:"jobs"`
+	// Rate is the average arrivals per second, the arrivals are a Poisson process
+	Rate float64 `json:"rate"`
+	// MeanDuration is the average run time, the run times are exponentially distributed
+	MeanDuration Duration `json:"mean_duration"`
+	// Priorities is the number of priorities the jobs are spread over evenly
+	Priorities  int      `json:"priorities"`
+	Deadline    Duration `json:"deadline"`
+	FailureRate float64  `json:"failure_rate"`
+	Retries     uint     `json:"retries"`
+	Seed        int64    `json:"seed"`
+}
+
+// SyntheticWorkload returns a random workload described by c
+func SyntheticWorkload(c WorkloadConfig) Workload {
+	r := rand.New(rand.NewSource(c.Seed))
+	w := make(Workload, 0, c.Jobs)
+
+	var arrival time.Duration
+	for i := 0; i < c.Jobs; i++ {
+		if c.Rate > 0 {
+			arrival += time.Duration(r.ExpFloat64() / c.Rate * float64(time.Second))
+		}
+
+		priority := 0
+		if c.Priorities > 1 {
+			priority = r.Intn(c.Priorities)
+		}
+
+		w = append(w, Job{
+			ID:          "job-" + strconv.Itoa(i),
+			Arrival:     arrival,
+			Duration:    time.Duration(r.ExpFloat64() * float64(c.MeanDuration)),
+			Priority:    priority,
+			Deadline:    time.Duration(c.Deadline),
+			FailureRate: c.FailureRate,
+			Retries:     c.Retries,
+		})
+	}
+
+	return w
+}
+
+// Record is a task run in the past, such as a row of the task history
+type Record struct {
+	ID       string
+	Created  time.Time
+	Started  time.Time
+	Finished time.Time
+	Priority int
+	Failed   bool
+}
+
+// ReplayWorkload returns the workload of records, the jobs arrive as the records were created
+// and run as long as they did. The failed records fail again without retries.
+func ReplayWorkload(records []Record) Workload {
+	sorted := make([]Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created.Before(sorted[j].Created)
+	})
+
+	w := make(Workload, 0, len(sorted))
+	for _, r := range sorted {
+		job := Job{
+			ID:       r.ID,
+			Arrival:  r.Created.Sub(sorted[0].Created),
+			Duration: r.Finished.Sub(r.Started),
+			Priority: r.Priority,
+		}
+		if r.Failed {
+			job.FailureRate = 1
+		}
+
+		w = append(w, job)
+	}
+
+	return w
+}
+
+// SimulationConfig is the scheduler a workload is simulated on
+type SimulationConfig struct {
+	Workers int
+	// Compare sorts the queue such as CompareByPriority, nil means first come first served
+	Compare CompareFunc
+	// Capacity and Policy bound the queue as NewBoundedQueue, Block is taken as Reject since
+	// the arrivals can't wait
+	Capacity int
+	Policy   OverflowPolicy
+	// Seed decides which attempts fail
+	Seed int64
+}
+
+// SimulationReport is the result of a simulation
+type SimulationReport struct {
+	Jobs      int `json:"jobs"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Retries   int `json:"retries"`
+	// Rejected and Dropped are the jobs turned away by a full queue
+	Rejected       int `json:"rejected"`
+	Dropped        int `json:"dropped"`
+	DeadlineMisses int `json:"deadline_misses"`
+	// Makespan is the virtual time from the first arrival to the last finish
+	Makespan Duration `json:"makespan"`
+	// Throughput is the finished jobs per second
+	Throughput float64 `json:"throughput"`
+	// Utilization is the share of the worker time spent on running jobs
+	Utilization float64 `json:"utilization"`
+	// the waits are the times the attempts spend in the queue
+	MeanWait Duration `json:"mean_wait"`
+	P50Wait  Duration `json:"p50_wait"`
+	P95Wait  Duration `json:"p95_wait"`
+	P99Wait  Duration `json:"p99_wait"`
+	MaxWait  Duration `json:"max_wait"`
+	// Ignored is the features of the scheduler the simulation leaves out
+	Ignored []string `json:"ignored"`
+}
+
+// simJob is the state of a job during a simulation
+type simJob struct {
+	job      Job
+	task     *task
+	attempts uint
+	queuedAt time.Duration
+	endAt    time.Duration
+	failing  bool
+}
+
+// simEpoch is the virtual time a simulation starts at
+var simEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// simIgnored is what a simulation leaves out of the scheduler, reported with its result
+var simIgnored = []string{
+	"breakers",
+	"resources and backfill",
+	"calendars",
+	"ttl and load shedding",
+	"deadline admission",
+	"work stealing",
+}
+
+// Simulate runs w on a scheduler configured as c with a virtual clock, so no real time
+// passes. The queue is the one the scheduler uses, so that the tasks are dispatched in the
+// same order. It's a dispatch loop of its own though, the breakers, resources and backfill,
+// calendars, TTL and load shedding, deadline admission and work stealing aren't simulated,
+// so the report is an estimate of the queueing only, they are listed in its Ignored.
+func Simulate(w Workload, c SimulationConfig) SimulationReport {
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	policy := c.Policy
+	if policy == Block {
+		policy = Reject
+	}
+	q := NewBoundedQueue(c.Capacity, policy)
+	q.SetCompareFunc(c.Compare)
+
+	jobs := make(Workload, len(w))
+	copy(jobs, w)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Arrival < jobs[j].Arrival
+	})
+
+	report := SimulationReport{Jobs: len(jobs), Ignored: simIgnored}
+	r := rand.New(rand.NewSource(c.Seed))
+	byTask := map[*task]*simJob{}
+	var (
+		now     time.Duration
+		running []*simJob
+		waits   []time.Duration
+		busy    time.Duration
+	)
+
+	finish := func(j *simJob, succeeded bool) {
+		if succeeded {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+		if j.job.Deadline > 0 && now > j.job.Arrival+j.job.Deadline {
+			report.DeadlineMisses++
+		}
+	}
+
+	arrive := func(job Job) {
+		j := &simJob{job: job, queuedAt: now}
+		j.task = &task{id: job.ID, priority: job.Priority}
+		if job.Deadline > 0 {
+			j.task.deadline = simEpoch.Add(job.Arrival + job.Deadline)
+		}
+		// the evicted tasks are completed with ErrDropped
+		j.task.outcomeFuncs = []OutcomeFunc{func(ctx context.Context, o Outcome) {
+			if o.Reason == ErrDropped {
+				report.Dropped++
+			}
+		}}
+		byTask[j.task] = j
+
+		if err := q.Add(context.Background(), j.task); err != nil {
+			report.Rejected++
+		}
+	}
+
+	next := 0
+	for next < len(jobs) || len(running) > 0 || !q.IsEmpty() {
+		// the next event is either an arrival or a finish
+		at := time.Duration(math.MaxInt64)
+		if next < len(jobs) {
+			at = jobs[next].Arrival
+		}
+		for _, j := range running {
+			if j.endAt < at {
+				at = j.endAt
+			}
+		}
+		if at == time.Duration(math.MaxInt64) {
+			break
+		}
+		now = at
+
+		left := running[:0]
+		for _, j := range running {
+			if j.endAt > now {
+				left = append(left, j)
+				continue
+			}
+
+			q.Done(j.task)
+			if !j.failing {
+				finish(j, true)
+			} else if j.attempts <= j.job.Retries {
+				report.Retries++
+				j.queuedAt = now
+				if err := q.Add(context.Background(), j.task); err != nil {
+					finish(j, false)
+				}
+			} else {
+				finish(j, false)
+			}
+		}
+		running = left
+
+		for next < len(jobs) && jobs[next].Arrival == now {
+			arrive(jobs[next])
+			next++
+		}
+
+		for len(running) < workers {
+			t, ok := q.TryGet(func(Task) bool { return true })
+			if !ok {
+				break
+			}
+
+			j := byTask[t.(*task)]
+			j.attempts++
+			j.endAt = now + j.job.Duration
+			j.failing = r.Float64() < j.job.FailureRate
+			waits = append(waits, now-j.queuedAt)
+			busy += j.job.Duration
+			running = append(running, j)
+		}
+	}
+
+	var makespan time.Duration
+	if len(jobs) > 0 {
+		makespan = now - jobs[0].Arrival
+	}
+	report.Makespan = Duration(makespan)
+	if makespan > 0 {
+		report.Throughput = float64(report.Succeeded+report.Failed) / makespan.Seconds()
+		report.Utilization = float64(busy) / float64(makespan*time.Duration(workers))
+	}
+
+	if len(waits) > 0 {
+		sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+
+		var total time.Duration
+		for _, wait := range waits {
+			total += wait
+		}
+		report.MeanWait = Duration(total / time.Duration(len(waits)))
+		report.P50Wait = Duration(percentile(waits, 0.50))
+		report.P95Wait = Duration(percentile(waits, 0.95))
+		report.P99Wait = Duration(percentile(waits, 0.99))
+		report.MaxWait = Duration(waits[len(waits)-1])
+	}
+
+	return report
+}
+
+// percentile returns the p-th percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
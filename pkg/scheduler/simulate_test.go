@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	w := Workload{
+		{ID: "a", Duration: time.Second},
+		{ID: "b", Duration: time.Second},
+		{ID: "c", Duration: time.Second},
+	}
+
+	report := Simulate(w, SimulationConfig{Workers: 1})
+	if report.Succeeded != 3 || report.Makespan != Duration(3*time.Second) || report.MaxWait != Duration(2*time.Second) ||
+		report.MeanWait != Duration(time.Second) || report.Throughput != 1 || report.Utilization != 1 {
+		t.Errorf("report is unexpected: %+v", report)
+	}
+	if len(report.Ignored) == 0 {
+		t.Errorf("ignored features are expected in the report")
+	}
+
+	w = Workload{
+		{ID: "fails", Duration: time.Second, FailureRate: 1, Retries: 2},
+	}
+	if report := Simulate(w, SimulationConfig{Workers: 1}); report.Failed != 1 || report.Retries != 2 ||
+		report.Makespan != Duration(3*time.Second) {
+		t.Errorf("report of retries is unexpected: %+v", report)
+	}
+}
+
+func TestSimulatePolicies(t *testing.T) {
+	w := Workload{
+		{ID: "a", Duration: time.Second, Priority: 5},
+		{ID: "b", Duration: time.Second, Priority: 5},
+		{ID: "urgent", Arrival: 500 * time.Millisecond, Duration: time.Second, Deadline: 2 * time.Second},
+	}
+
+	if report := Simulate(w, SimulationConfig{Workers: 1}); report.DeadlineMisses != 1 {
+		t.Errorf("urgent job is expected to miss its deadline first come first served: %+v", report)
+	}
+
+	if report := Simulate(w, SimulationConfig{Workers: 1, Compare: CompareByPriority}); report.DeadlineMisses != 0 {
+		t.Errorf("urgent job is expected to run before the others by priority: %+v", report)
+	}
+
+	if report := Simulate(w, SimulationConfig{Workers: 1, Capacity: 1, Policy: Reject}); report.Rejected != 1 ||
+		report.Succeeded != 2 {
+		t.Errorf("report of a full queue is unexpected: %+v", report)
+	}
+}
+
+func TestSimulateSynthetic(t *testing.T) {
+	w := SyntheticWorkload(WorkloadConfig{
+		Jobs:         1000,
+		Rate:         10,
+		MeanDuration: Duration(300 * time.Millisecond),
+		Priorities:   3,
+		Seed:         1,
+	})
+	if len(w) != 1000 {
+		t.Fatalf("jobs are expected as 1000, actually %d", len(w))
+	}
+
+	small := Simulate(w, SimulationConfig{Workers: 3})
+	large := Simulate(w, SimulationConfig{Workers: 6})
+	if small.Succeeded != 1000 || large.Succeeded != 1000 {
+		t.Fatalf("jobs are expected to succeed: %+v %+v", small, large)
+	}
+	if large.MeanWait >= small.MeanWait {
+		t.Errorf("more workers are expected to wait less: %v >= %v", large.MeanWait, small.MeanWait)
+	}
+
+	if again := Simulate(w, SimulationConfig{Workers: 3}); !reflect.DeepEqual(again, small) {
+		t.Errorf("simulation is expected to be deterministic: %+v != %+v", again, small)
+	}
+
+	start := time.Now()
+	replayed := ReplayWorkload([]Record{
+		{ID: "2", Created: start.Add(time.Second), Started: start.Add(2 * time.Second), Finished: start.Add(4 * time.Second)},
+		{ID: "1", Created: start, Started: start, Finished: start.Add(time.Second), Failed: true},
+	})
+	if replayed[0].ID != "1" || replayed[0].FailureRate != 1 || replayed[1].Arrival != time.Second ||
+		replayed[1].Duration != 2*time.Second {
+		t.Errorf("replayed workload is unexpected: %+v", replayed)
+	}
+}
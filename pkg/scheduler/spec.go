@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownHandler is returned when a TaskSpec names a handler isn't registered
+	ErrUnknownHandler = errors.New("unknown task handler")
+	// ErrDuplicateHandler is returned when a handler name is registered twice
+	ErrDuplicateHandler = errors.New("task handler already registered")
+	// ErrInvalidSpec is returned when a TaskSpec can't be turned into a task
+	ErrInvalidSpec = errors.New("invalid task spec")
+)
+
+// HandlerFunc runs the tasks of a handler name with the payload of their TaskSpec
+type HandlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// TaskSpec describes a task as data, so that it can be stored, sent and replayed. The
+// handler runs it is looked up by name in the Registry of the scheduler.
+type TaskSpec struct {
+	ID      string          `json:"id,omitempty"`
+	Handler string          `json:"handler"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Queue is the name of the scheduler the task is for, empty for any
+	Queue    string `json:"queue,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+
+	Priority  int       `json:"priority,omitempty"`
+	Retry     uint      `json:"retry,omitempty"`
+	Timeout   Duration  `json:"timeout,omitempty"`
+	Deadline  time.Time `json:"deadline,omitempty"`
+	TTL       Duration  `json:"ttl,omitempty"`
+	Breaker   string    `json:"breaker,omitempty"`
+	Resources Resources `json:"resources,omitempty"`
+	Selector  Selector  `json:"selector,omitempty"`
+	Calendar  Calendar  `json:"calendar,omitempty"`
+}
+
+// Validate checks whether spec is well formed, the handler isn't looked up
+func (spec TaskSpec) Validate() error {
+	if spec.Handler == "" {
+		return fmt.Errorf("%w: no handler", ErrInvalidSpec)
+	}
+	if spec.Timeout < 0 || spec.TTL < 0 {
+		return fmt.Errorf("%w: negative timeout or ttl", ErrInvalidSpec)
+	}
+	if len(spec.Payload) > 0 && !json.Valid(spec.Payload) {
+		return fmt.Errorf("%w: payload isn't valid JSON", ErrInvalidSpec)
+	}
+
+	return nil
+}
+
+// PrepareFunc is called with a TaskSpec of its handler before it's turned into a task, so that
+// the owner of the handler can check it and give it an id, such as the one of a database row
+type PrepareFunc func(spec *TaskSpec) error
+
+// Registry maps the handler names of the task specs to the Go functions run them
+type Registry struct {
+	mu        sync.RWMutex
+	handlers  map[string]HandlerFunc
+	preparers map[string]PrepareFunc
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:  map[string]HandlerFunc{},
+		preparers: map[string]PrepareFunc{},
+	}
+}
+
+// Register adds h as the handler named name
+func (r *Registry) Register(name string, h HandlerFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateHandler, name)
+	}
+
+	r.handlers[name] = h
+	return nil
+}
+
+// Prepare sets f as the PrepareFunc of the handler named name, the handler must be
+// registered first
+func (r *Registry) Prepare(name string, f PrepareFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.handlers[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownHandler, name)
+	}
+
+	r.preparers[name] = f
+	return nil
+}
+
+// Handler returns the handler named name
+func (r *Registry) Handler(name string) (HandlerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+// Names returns the sorted names of the handlers
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Task returns the task spec describes, it runs the handler in r
+func (r *Registry) Task(spec TaskSpec) (Task, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	h, ok := r.Handler(spec.Handler)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownHandler, spec.Handler)
+	}
+
+	r.mu.RLock()
+	prepare := r.preparers[spec.Handler]
+	r.mu.RUnlock()
+
+	if prepare != nil {
+		if err := prepare(&spec); err != nil {
+			return nil, err
+		}
+	}
+
+	payload := spec.Payload
+	t := &task{
+		id: spec.ID,
+		task: TaskFunc(func(ctx context.Context) error {
+			return h(ctx, payload)
+		}),
+		spec:       &spec,
+		priority:   spec.Priority,
+		retryTimes: spec.Retry,
+		deadline:   spec.Deadline,
+		ttl:        time.Duration(spec.TTL),
+		breaker:    spec.Breaker,
+		resources:  spec.Resources,
+		selector:   spec.Selector,
+		calendar:   spec.Calendar,
+	}
+	// a deadline replaces the timeout, as WithDeadline does
+	if spec.Deadline.IsZero() {
+		t.timeout = time.Duration(spec.Timeout)
+	}
+
+	return t, nil
+}
+
+// WithRegistry sets the handlers of the task specs submitted to the scheduler, an empty
+// Registry is used by default
+func WithRegistry(r *Registry) Option {
+	return func(s *Scheduler) {
+		s.registry = r
+	}
+}
+
+// Registry returns the handlers of the task specs
+func (s *Scheduler) Registry() *Registry {
+	return s.registry
+}
+
+// Submit schedules the task described by spec, as a child if it has a ParentID. It returns
+// the id of the task, the one given by spec, by the PrepareFunc or by the scheduler.
+func (s *Scheduler) Submit(spec TaskSpec) (string, error) {
+	if spec.Queue != "" && spec.Queue != s.name {
+		return "", fmt.Errorf("%w: queue %s isn't %s", ErrInvalidSpec, spec.Queue, s.name)
+	}
+
+	t, err := s.registry.Task(spec)
+	if err != nil {
+		return "", err
+	}
+
+	if spec.ParentID != "" {
+		err = s.ScheduleChild(spec.ParentID, t)
+	} else {
+		err = s.Schedule(t)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return t.(*task).id, nil
+}
+
+// Spec returns the spec of the scheduled task with id, so that it can be stored and submitted
+// again, ErrTaskNotFound is returned if there isn't one submitted by a spec
+func (s *Scheduler) Spec(id string) (TaskSpec, error) {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	t, ok := s.tasks[id]
+	if !ok || t.spec == nil {
+		return TaskSpec{}, ErrTaskNotFound
+	}
+
+	spec := *t.spec
+	spec.ID = t.id
+	return spec, nil
+}
+
+// handler returns the handler name of the spec t is submitted by, empty if it isn't
+func (t *task) handler() string {
+	if t.spec == nil {
+		return ""
+	}
+
+	return t.spec.Handler
+}
@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSubmit(t *testing.T) {
+	s := New()
+
+	sums := make(chan int, 2)
+	release := make(chan struct{})
+	err := s.Registry().Register("sum", func(ctx context.Context, payload json.RawMessage) error {
+		<-release
+
+		var numbers []int
+		if err := json.Unmarshal(payload, &numbers); err != nil {
+			return err
+		}
+
+		sum := 0
+		for _, n := range numbers {
+			sum += n
+		}
+		sums <- sum
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Registry().Register("sum", nil); !errors.Is(err, ErrDuplicateHandler) {
+		t.Errorf("error is expected as %v, actually %v", ErrDuplicateHandler, err)
+	}
+
+	go s.Start(1)
+
+	var spec TaskSpec
+	if err := json.Unmarshal([]byte(`{"id": "sum-1", "handler": "sum", "payload": [1, 2, 3], "priority": 2}`), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.Submit(spec); err != nil || id != "sum-1" {
+		t.Fatalf("id is expected as sum-1, actually %q %v", id, err)
+	}
+	if _, err := s.Submit(spec); !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("error is expected as %v, actually %v", ErrDuplicateTask, err)
+	}
+
+	stored, err := s.Spec("sum-1")
+	if err != nil || stored.Handler != "sum" || string(stored.Payload) != "[1, 2, 3]" || stored.Priority != 2 {
+		t.Errorf("spec is unexpected: %+v %v", stored, err)
+	}
+
+	snapshot := s.Snapshot()
+	for len(snapshot.Running) == 0 {
+		snapshot = s.Snapshot()
+	}
+	if len(snapshot.Running) != 1 || snapshot.Running[0].Handler != "sum" {
+		t.Errorf("running is unexpected: %+v", snapshot.Running)
+	}
+
+	// the spec is replayed as another task
+	stored.ID = "sum-2"
+	if _, err := s.Submit(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if sum := <-sums; sum != 6 {
+			t.Errorf("sum is expected as 6, actually %d", sum)
+		}
+	}
+
+	if _, err := s.Submit(TaskSpec{Handler: "unknown"}); !errors.Is(err, ErrUnknownHandler) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnknownHandler, err)
+	}
+	if _, err := s.Submit(TaskSpec{Handler: "sum", Queue: "other"}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("error is expected as %v, actually %v", ErrInvalidSpec, err)
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestSubmitPrepare(t *testing.T) {
+	s := New()
+
+	ids := make(chan string, 2)
+	err := s.Registry().Register("echo", func(ctx context.Context, payload json.RawMessage) error {
+		id, _ := TaskIDFromContext(ctx)
+		ids <- id
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Registry().Prepare("unknown", nil); !errors.Is(err, ErrUnknownHandler) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnknownHandler, err)
+	}
+
+	// the prepare func gives the ids, such as the ones of database rows
+	rows := 0
+	err = s.Registry().Prepare("echo", func(spec *TaskSpec) error {
+		if string(spec.Payload) == `"invalid"` {
+			return ErrInvalidSpec
+		}
+		if spec.ID == "" {
+			rows++
+			spec.ID = strconv.Itoa(rows)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start(1)
+
+	if _, err := s.Submit(TaskSpec{Handler: "echo", Payload: json.RawMessage(`"invalid"`)}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("error is expected as %v, actually %v", ErrInvalidSpec, err)
+	}
+
+	id, err := s.Submit(TaskSpec{Handler: "echo"})
+	if err != nil || id != "1" {
+		t.Errorf("id is expected as 1, actually %q %v", id, err)
+	}
+	if running := <-ids; running != id {
+		t.Errorf("id in the handler is expected as %q, actually %q", id, running)
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestGeneratedID(t *testing.T) {
+	s := New()
+	release := make(chan struct{})
+	blocked := TaskFunc(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	generated := NewTask(blocked).BindScheduler(s).(*task)
+	if _, err := strconv.Atoi(generated.id); err == nil {
+		t.Errorf("generated id %q is expected not to be a number", generated.id)
+	}
+
+	if err := s.Schedule(generated); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Schedule(blocked.WithID(generated.id)); !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("error is expected as %v, actually %v", ErrDuplicateTask, err)
+	}
+
+	go s.Start(1)
+	close(release)
+	s.Wait()
+	s.Stop()
+}
@@ -0,0 +1,596 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// the states of a task in a stealingQueue, they play the role of the dirty and running sets
+// of Type
+const (
+	stateIdle int32 = iota
+	stateQueued
+	stateRunning
+	// stateRunningDirty means the task is added again while it's running
+	stateRunningDirty
+)
+
+// WithWorkStealing makes the workers pull tasks by themselves instead of waiting for the
+// dispatcher. Every worker has a local deque the tasks are spread over, tasks must be
+// dispatched by a compare function are kept in a global queue split into shards. The
+// capacity and the policy of a queue set by NewBoundedQueue before are kept.
+func WithWorkStealing(shards int) Option {
+	return func(s *Scheduler) {
+		capacity, policy := 0, Block
+		if q, ok := s.queue.(*Type); ok {
+			capacity, policy = q.capacity, q.policy
+		}
+
+		s.queue = NewBoundedStealingQueue(shards, capacity, policy)
+	}
+}
+
+// stealingQueue is the Queue used by the work-stealing mode
+type stealingQueue struct {
+	// pending counts the tasks added and not done yet
+	pending int64
+	// waiting counts the tasks in the shards and the deques, and the ones being put there
+	waiting int64
+	seq     uint64
+	next    uint64
+
+	capacity int
+	policy   OverflowPolicy
+	// room is closed when a task leaves a full queue
+	roomMu sync.Mutex
+	room   chan struct{}
+
+	shards      []*shard
+	compareFunc CompareFunc
+
+	localMu sync.RWMutex
+	locals  []*deque
+
+	parkMu sync.Mutex
+	parked []chan struct{}
+}
+
+// NewStealingQueue returns the Queue of the work-stealing mode with the global queue split
+// into shards, it only holds tasks bound to a scheduler.
+//
+// Every task is stamped with a sequence number when it's added. A worker takes the first
+// task it accepts across the shards and the deques by the compare function, then by the
+// sequence number, so the tasks are dispatched in the order they are added as in Type.
+// Taking from the deque of another worker is stealing.
+func NewStealingQueue(shards int) Queue {
+	return NewBoundedStealingQueue(shards, 0, Block)
+}
+
+// NewBoundedStealingQueue returns the Queue of the work-stealing mode holds at most capacity
+// waiting tasks, policy decides what to do when it's full as in NewBoundedQueue. A capacity
+// of 0 means no limit.
+func NewBoundedStealingQueue(shards, capacity int, policy OverflowPolicy) Queue {
+	if shards <= 0 {
+		shards = 1
+	}
+
+	q := &stealingQueue{
+		capacity: capacity,
+		policy:   policy,
+		room:     make(chan struct{}),
+	}
+	for i := 0; i < shards; i++ {
+		q.shards = append(q.shards, &shard{})
+	}
+
+	return q
+}
+
+// entry is a task in a shard or a deque, seq keeps the order it's added
+type entry struct {
+	t   Task
+	seq uint64
+}
+
+// container is a shard or a deque
+type container interface {
+	// first returns the first accepted entry in order
+	first(accept func(Task) bool) (entry, bool)
+	// remove takes t out, it returns false if t isn't there
+	remove(t Task) bool
+	// all returns the entries
+	all() []entry
+}
+
+// Add add a new Task to Queue
+func (q *stealingQueue) Add(ctx context.Context, t Task) error {
+	realTask := t.(*task)
+	for {
+		switch state := atomic.LoadInt32(&realTask.qstate); state {
+		case stateQueued, stateRunningDirty:
+			return nil
+		case stateRunning:
+			if atomic.CompareAndSwapInt32(&realTask.qstate, stateRunning, stateRunningDirty) {
+				return nil
+			}
+		default:
+			if atomic.CompareAndSwapInt32(&realTask.qstate, stateIdle, stateQueued) {
+				if err := q.reserve(ctx, realTask, q.policy == Block); err != nil {
+					atomic.StoreInt32(&realTask.qstate, stateIdle)
+					return err
+				}
+
+				atomic.AddInt64(&q.pending, 1)
+				q.push(realTask)
+				return nil
+			}
+		}
+	}
+}
+
+// reserve takes a place for t among the waiting tasks, it makes room by the policy when the
+// queue is full and waits for room only if block is true. The place is given back by leave.
+func (q *stealingQueue) reserve(ctx context.Context, t *task, block bool) error {
+	for {
+		q.roomMu.Lock()
+		room := q.room
+		q.roomMu.Unlock()
+
+		n := atomic.AddInt64(&q.waiting, 1)
+		if q.capacity <= 0 || n <= int64(q.capacity) {
+			return nil
+		}
+		atomic.AddInt64(&q.waiting, -1)
+
+		switch {
+		case q.policy == DropOldest || q.policy == DropLowestPriority:
+			victim, ok := q.victim(t)
+			if !ok {
+				return ErrQueueFull
+			}
+			if q.Remove(victim) {
+				drop(victim)
+			}
+		case block:
+			select {
+			case <-room:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		default:
+			return ErrQueueFull
+		}
+	}
+}
+
+// victim returns the task to drop for t by the policy, the oldest one or the one would be
+// dispatched last. It returns false if t ranks last itself.
+func (q *stealingQueue) victim(t Task) (Task, bool) {
+	var (
+		found  bool
+		victim entry
+	)
+	lowest := q.policy == DropLowestPriority && q.compareFunc != nil
+	q.each(func(c container) {
+		for _, e := range c.all() {
+			if !found || lowest && before(victim, e, q.compareFunc) || !lowest && e.seq < victim.seq {
+				victim, found = e, true
+			}
+		}
+	})
+
+	if !found || lowest && !q.compareFunc(t, victim.t) {
+		return nil, false
+	}
+
+	return victim.t, true
+}
+
+// leave gives back the place of a task taken out of the shards or the deques
+func (q *stealingQueue) leave() {
+	atomic.AddInt64(&q.waiting, -1)
+	if q.capacity <= 0 {
+		return
+	}
+
+	q.roomMu.Lock()
+	close(q.room)
+	q.room = make(chan struct{})
+	q.roomMu.Unlock()
+}
+
+// push puts t in a shard if it must be dispatched by the compare function or no worker is
+// registered yet, otherwise in the deque of a worker by turns
+func (q *stealingQueue) push(t *task) {
+	q.localMu.RLock()
+	locals := q.locals
+	q.localMu.RUnlock()
+
+	n := atomic.AddUint64(&q.next, 1)
+	e := entry{t: t, seq: atomic.AddUint64(&q.seq, 1)}
+	if q.compareFunc == nil && len(locals) > 0 {
+		locals[n%uint64(len(locals))].push(e)
+	} else {
+		q.shards[n%uint64(len(q.shards))].push(e, q.compareFunc)
+	}
+
+	if t.resources.IsZero() && len(t.selector.Required) == 0 {
+		q.wakeOne()
+	} else {
+		// not every worker can take it, let them all have a look
+		q.wakeAll()
+	}
+}
+
+// Get return a task
+func (q *stealingQueue) Get() Task {
+	wake := make(chan struct{}, 1)
+	accept := func(Task) bool { return true }
+
+	for {
+		if t, ok := q.TryGet(accept); ok {
+			return t
+		}
+
+		if t, ok := q.park(wake, func() (Task, bool) { return q.TryGet(accept) }); ok {
+			return t
+		}
+		<-wake
+	}
+}
+
+// TryGet returns the first task accepted in dispatch order without blocking. The heads of
+// the shards and the deques are compared, then the first one is taken out, it looks again if
+// another worker takes the task in between.
+func (q *stealingQueue) TryGet(accept func(Task) bool) (Task, bool) {
+	for atomic.LoadInt64(&q.waiting) > 0 {
+		var (
+			found bool
+			first entry
+			from  container
+		)
+		q.each(func(c container) {
+			if e, ok := c.first(accept); ok && (!found || before(e, first, q.compareFunc)) {
+				found, first, from = true, e, c
+			}
+		})
+
+		if !found {
+			return nil, false
+		}
+
+		if from.remove(first.t) {
+			q.leave()
+			return q.take(first.t), true
+		}
+	}
+
+	return nil, false
+}
+
+// Done means that the Task has finished, a task added again while it was running is queued
+// by the policy as if it were added now. It can't wait for room, so Block refuses it as Reject.
+func (q *stealingQueue) Done(t Task) {
+	realTask := t.(*task)
+	for {
+		switch atomic.LoadInt32(&realTask.qstate) {
+		case stateRunningDirty:
+			if atomic.CompareAndSwapInt32(&realTask.qstate, stateRunningDirty, stateQueued) {
+				if err := q.reserve(context.Background(), realTask, false); err != nil {
+					q.forget(realTask)
+					reject(realTask)
+					return
+				}
+
+				q.push(realTask)
+				return
+			}
+		default:
+			if atomic.CompareAndSwapInt32(&realTask.qstate, stateRunning, stateIdle) {
+				atomic.AddInt64(&q.pending, -1)
+				return
+			}
+		}
+	}
+}
+
+// Remove takes t out of the shards or the deques, a running task added again is only
+// forgotten so that it won't run again
+func (q *stealingQueue) Remove(t Task) bool {
+	realTask := t.(*task)
+	if atomic.CompareAndSwapInt32(&realTask.qstate, stateRunningDirty, stateRunning) {
+		return false
+	}
+
+	removed := false
+	q.each(func(c container) {
+		if !removed && c.remove(t) {
+			removed = true
+		}
+	})
+
+	if !removed {
+		return false
+	}
+
+	q.leave()
+	return q.forget(realTask)
+}
+
+// Tasks returns the waiting tasks in dispatch order
+func (q *stealingQueue) Tasks() []Task {
+	var entries []entry
+	q.each(func(c container) {
+		entries = append(entries, c.all()...)
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		return before(entries[i], entries[j], q.compareFunc)
+	})
+
+	var tasks []Task
+	for _, e := range entries {
+		tasks = append(tasks, e.t)
+	}
+
+	return tasks
+}
+
+// each calls f with the shards, then the deques
+func (q *stealingQueue) each(f func(c container)) {
+	for _, s := range q.shards {
+		f(s)
+	}
+
+	q.localMu.RLock()
+	locals := q.locals
+	q.localMu.RUnlock()
+
+	for _, d := range locals {
+		f(d)
+	}
+}
+
+// forget marks the removed task t as idle
+func (q *stealingQueue) forget(t *task) bool {
+	atomic.StoreInt32(&t.qstate, stateIdle)
+	atomic.AddInt64(&q.pending, -1)
+	return true
+}
+
+// SetCompareFunc set the func used for sorting, all the tasks are kept in the shards then
+func (q *stealingQueue) SetCompareFunc(f CompareFunc) {
+	q.compareFunc = f
+}
+
+// IsEmpty tells the user whether the queue is empty
+func (q *stealingQueue) IsEmpty() bool {
+	return atomic.LoadInt64(&q.pending) == 0
+}
+
+// register adds a deque for a new worker
+func (q *stealingQueue) register() {
+	q.localMu.Lock()
+	defer q.localMu.Unlock()
+
+	locals := make([]*deque, len(q.locals), len(q.locals)+1)
+	copy(locals, q.locals)
+	q.locals = append(locals, &deque{})
+}
+
+// take marks t as running
+func (q *stealingQueue) take(t Task) Task {
+	atomic.StoreInt32(&t.(*task).qstate, stateRunning)
+	return t
+}
+
+// park registers wake to be signalled when tasks are added, then tries get once more in case
+// a task is added before the registration. The registration is cancelled if a task is got.
+func (q *stealingQueue) park(wake chan struct{}, get func() (Task, bool)) (Task, bool) {
+	q.parkMu.Lock()
+	q.parked = append(q.parked, wake)
+	q.parkMu.Unlock()
+
+	t, ok := get()
+	if ok {
+		q.parkMu.Lock()
+		for i, c := range q.parked {
+			if c == wake {
+				q.parked = append(q.parked[:i], q.parked[i+1:]...)
+				break
+			}
+		}
+		q.parkMu.Unlock()
+	}
+
+	return t, ok
+}
+
+// wakeOne wakes a parked worker up
+func (q *stealingQueue) wakeOne() {
+	q.parkMu.Lock()
+	if len(q.parked) == 0 {
+		q.parkMu.Unlock()
+		return
+	}
+
+	wake := q.parked[len(q.parked)-1]
+	q.parked = q.parked[:len(q.parked)-1]
+	q.parkMu.Unlock()
+
+	signal(wake)
+}
+
+// wakeAll wakes all the parked workers up
+func (q *stealingQueue) wakeAll() {
+	q.parkMu.Lock()
+	parked := q.parked
+	q.parked = nil
+	q.parkMu.Unlock()
+
+	for _, wake := range parked {
+		signal(wake)
+	}
+}
+
+// signal sends to c without blocking
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// before reports whether e1 is dispatched before e2
+func before(e1, e2 entry, compareFunc CompareFunc) bool {
+	if compareFunc != nil {
+		if compareFunc(e1.t, e2.t) {
+			return true
+		}
+		if compareFunc(e2.t, e1.t) {
+			return false
+		}
+	}
+
+	return e1.seq < e2.seq
+}
+
+// shard is a part of the global queue, it's a heap when there is a compare function
+type shard struct {
+	mu          sync.Mutex
+	entries     []entry
+	compareFunc CompareFunc
+}
+
+// push adds e to the shard
+func (s *shard) push(e entry, compareFunc CompareFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compareFunc = compareFunc
+	heap.Push(s, e)
+}
+
+// first returns the first accepted entry in order, the head is checked first since it's
+// accepted by most workers
+func (s *shard) first(accept func(Task) bool) (entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) == 0 {
+		return entry{}, false
+	}
+	if accept(s.entries[0].t) {
+		return s.entries[0], true
+	}
+
+	var (
+		found bool
+		first entry
+	)
+	for _, e := range s.entries[1:] {
+		if accept(e.t) && (!found || before(e, first, s.compareFunc)) {
+			found, first = true, e
+		}
+	}
+
+	return first, found
+}
+
+// remove takes t out of the shard
+func (s *shard) remove(t Task) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.entries {
+		if e.t == t {
+			heap.Remove(s, i)
+			return true
+		}
+	}
+
+	return false
+}
+
+// all returns the entries of the shard
+func (s *shard) all() []entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]entry{}, s.entries...)
+}
+
+// Len is the heap.Interface implementation
+func (s *shard) Len() int { return len(s.entries) }
+
+// Less is the heap.Interface implementation
+func (s *shard) Less(i, j int) bool { return before(s.entries[i], s.entries[j], s.compareFunc) }
+
+// Swap is the heap.Interface implementation
+func (s *shard) Swap(i, j int) { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+
+// Push is the heap.Interface implementation
+func (s *shard) Push(x interface{}) { s.entries = append(s.entries, x.(entry)) }
+
+// Pop is the heap.Interface implementation
+func (s *shard) Pop() interface{} {
+	n := len(s.entries)
+	e := s.entries[n-1]
+	s.entries = s.entries[:n-1]
+	return e
+}
+
+// deque is the local queue of a worker, the tasks are added to the back in order, both the
+// owner and the thieves take them from the front
+type deque struct {
+	mu      sync.Mutex
+	entries []entry
+}
+
+// push adds e to the back
+func (d *deque) push(e entry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries = append(d.entries, e)
+}
+
+// first returns the first accepted entry from the front
+func (d *deque) first(accept func(Task) bool) (entry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, e := range d.entries {
+		if accept(e.t) {
+			return e, true
+		}
+	}
+
+	return entry{}, false
+}
+
+// remove takes t out of the deque
+func (d *deque) remove(t Task) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, e := range d.entries {
+		if e.t == t {
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// all returns the entries of the deque
+func (d *deque) all() []entry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]entry{}, d.entries...)
+}
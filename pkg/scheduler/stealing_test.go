@@ -0,0 +1,322 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkStealing(t *testing.T) {
+	taskNum := 1000
+	var counter int64
+	s := New(WithWorkStealing(4))
+	go s.Start(4)
+
+	for i := 0; i < taskNum; i++ {
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			atomic.AddInt64(&counter, 1)
+			return nil
+		}))
+	}
+
+	s.Wait()
+	s.Stop()
+
+	if counter != int64(taskNum) {
+		t.Errorf("counter is expected as %d, actually %d", taskNum, counter)
+	}
+}
+
+func TestWorkStealingDuplicate(t *testing.T) {
+	var counter int64
+	release := make(chan struct{})
+	task := NewTask(TaskFunc(func(ctx context.Context) error {
+		atomic.AddInt64(&counter, 1)
+		<-release
+		return nil
+	}))
+
+	s := New(WithWorkStealing(2))
+	go s.Start(2)
+	for i := 0; i < 10; i++ {
+		s.Schedule(task)
+	}
+
+	close(release)
+	s.Wait()
+	s.Stop()
+
+	// the task may be added again once while it's running
+	if counter < 1 || counter > 2 {
+		t.Errorf("counter is expected as 1 or 2, actually %d", counter)
+	}
+}
+
+func TestWorkStealingRetry(t *testing.T) {
+	var counter int64
+	retryTimes := uint(3)
+	s := New(WithWorkStealing(2))
+	go s.Start(2)
+
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		atomic.AddInt64(&counter, 1)
+		return context.Canceled
+	}).WithRetry(retryTimes))
+
+	s.Wait()
+	s.Stop()
+
+	if counter != int64(retryTimes)+1 {
+		t.Errorf("counter is expected as %d, actually %d", retryTimes+1, counter)
+	}
+}
+
+func TestWorkStealingOrder(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		s := New(WithWorkStealing(4))
+		if sorted {
+			if err := s.SortByPriority(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go s.Start(1)
+
+		running, release := make(chan int, 10), make(chan struct{})
+		s.Schedule(TaskFunc(func(ctx context.Context) error {
+			<-release
+			return nil
+		}).WithPriority(0))
+
+		for i := 5; i >= 1; i-- {
+			i := i
+			s.Schedule(TaskFunc(func(ctx context.Context) error {
+				running <- i
+				return nil
+			}).WithPriority(i))
+		}
+
+		close(release)
+		s.Wait()
+		s.Stop()
+		close(running)
+
+		expected := 5
+		if sorted {
+			expected = 1
+		}
+		for i := range running {
+			if i != expected {
+				t.Errorf("sorted %v: running is expected as %d, actually %d", sorted, expected, i)
+			}
+			if sorted {
+				expected++
+			} else {
+				expected--
+			}
+		}
+	}
+}
+
+func TestWorkStealingAffinity(t *testing.T) {
+	s := New(WithWorkStealing(2), WithWorkerGroup(1, Labels{"runtime": "node"}))
+	go s.Start(2)
+
+	done := make(chan struct{})
+	s.Schedule(TaskFunc(func(ctx context.Context) error {
+		close(done)
+		return nil
+	}).WithSelector(Selector{Required: MatchLabels(Labels{"runtime": "node"})}))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("task is expected to run on the labeled worker")
+	}
+
+	s.Wait()
+	s.Stop()
+}
+
+func TestStealingQueueOrder(t *testing.T) {
+	q := NewStealingQueue(4).(*stealingQueue)
+	for i := 0; i < 3; i++ {
+		q.register()
+	}
+
+	var added []Task
+	for i := 0; i < 10; i++ {
+		task := NewTask(TaskFunc(func(ctx context.Context) error {
+			return nil
+		}))
+		added = append(added, task)
+		if err := q.Add(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tasks := q.Tasks(); len(tasks) != len(added) {
+		t.Fatalf("tasks are expected as %d, actually %d", len(added), len(tasks))
+	}
+
+	accept := func(Task) bool { return true }
+	for i, expected := range added {
+		if task, ok := q.TryGet(accept); !ok || task != expected {
+			t.Errorf("task %d is expected in the order it's added", i)
+		}
+	}
+}
+
+func TestStealingQueueBounded(t *testing.T) {
+	for _, policy := range []OverflowPolicy{Reject, DropOldest, DropLowestPriority} {
+		var dropped []int
+		q := NewBoundedStealingQueue(2, 2, policy)
+		q.SetCompareFunc(CompareByPriority)
+		q.(*stealingQueue).register()
+
+		for _, priority := range []int{2, 1} {
+			if err := q.Add(context.Background(), newPriorityTask(priority, &dropped)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := q.Add(context.Background(), newPriorityTask(3, &dropped))
+		switch policy {
+		case Reject, DropLowestPriority:
+			if !errors.Is(err, ErrQueueFull) || len(dropped) != 0 {
+				t.Errorf("policy %d: error is expected as %v, actually %v %v", policy, ErrQueueFull, err, dropped)
+			}
+		case DropOldest:
+			if err != nil || len(dropped) != 1 || dropped[0] != 2 {
+				t.Errorf("policy %d: dropped is expected as [2], actually %v %v", policy, dropped, err)
+			}
+		}
+
+		if policy == DropLowestPriority {
+			if err := q.Add(context.Background(), newPriorityTask(0, &dropped)); err != nil || len(dropped) != 1 || dropped[0] != 2 {
+				t.Errorf("policy %d: dropped is expected as [2], actually %v %v", policy, dropped, err)
+			}
+		}
+
+		if n := len(q.Tasks()); n != 2 {
+			t.Errorf("policy %d: tasks are expected as 2, actually %d", policy, n)
+		}
+	}
+}
+
+func TestStealingQueueBlock(t *testing.T) {
+	var dropped []int
+	q := NewBoundedStealingQueue(2, 1, Block)
+	if err := q.Add(context.Background(), newPriorityTask(1, &dropped)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Add(ctx, newPriorityTask(2, &dropped)); !errors.Is(err, context.Canceled) {
+		t.Errorf("error is expected as %v, actually %v", context.Canceled, err)
+	}
+
+	added := make(chan error)
+	go func() {
+		added <- q.Add(context.Background(), newPriorityTask(3, &dropped))
+	}()
+
+	q.Get()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Errorf("error is expected as nil, actually %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked add is expected to return after Get")
+	}
+}
+
+func TestWorkStealingBounded(t *testing.T) {
+	s := New(WithQueue(NewBoundedQueue(1, Reject)), WithWorkStealing(2))
+
+	q, ok := s.queue.(*stealingQueue)
+	if !ok || q.capacity != 1 || q.policy != Reject {
+		t.Fatalf("queue is expected to keep the capacity and the policy, actually %#v", s.queue)
+	}
+}
+
+// benchmarkDispatch schedules b.N trivial tasks from several goroutines to 8 workers
+func benchmarkDispatch(b *testing.B, opts ...Option) {
+	s := New(opts...)
+	go s.Start(8)
+	defer s.Stop()
+
+	f := TaskFunc(func(ctx context.Context) error {
+		return nil
+	})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Schedule(f)
+		}
+	})
+	s.Wait()
+}
+
+func BenchmarkDispatcher(b *testing.B) {
+	benchmarkDispatch(b)
+}
+
+func BenchmarkWorkStealing(b *testing.B) {
+	benchmarkDispatch(b, WithWorkStealing(8))
+}
+
+func BenchmarkWorkStealingSorted(b *testing.B) {
+	benchmarkDispatch(b, WithWorkStealing(8), func(s *Scheduler) {
+		s.SortByPriority()
+	})
+}
+
+// BenchmarkQueue compares the queues side by side without the workers, every goroutine adds
+// a task then takes the first one. The stealing queues have 8 shards and 8 deques.
+func BenchmarkQueue(b *testing.B) {
+	stealing := func(capacity int) func() Queue {
+		return func() Queue {
+			q := NewBoundedStealingQueue(8, capacity, Reject)
+			for i := 0; i < 8; i++ {
+				q.(*stealingQueue).register()
+			}
+			return q
+		}
+	}
+
+	queues := []struct {
+		name string
+		new  func() Queue
+	}{
+		{name: "Type", new: NewQueue},
+		{name: "TypeBounded", new: func() Queue { return NewBoundedQueue(1024, Reject) }},
+		{name: "Stealing", new: stealing(0)},
+		{name: "StealingBounded", new: stealing(1024)},
+	}
+
+	for _, queue := range queues {
+		queue := queue
+		b.Run(queue.name, func(b *testing.B) {
+			q := queue.new()
+			accept := func(Task) bool { return true }
+			f := TaskFunc(func(ctx context.Context) error {
+				return nil
+			})
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					q.Add(context.Background(), NewTask(f))
+					if t, ok := q.TryGet(accept); ok {
+						q.Done(t)
+					}
+				}
+			})
+		})
+	}
+}
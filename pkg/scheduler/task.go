@@ -2,7 +2,8 @@ package scheduler
 
 import (
 	"context"
-	"log"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/robertkrimen/otto"
@@ -25,11 +26,43 @@ type RetryTask interface {
 	WithCancelFunc(timeout time.Duration) (Task, context.CancelFunc)
 }
 
+type IdentifiedTask interface {
+	Task
+	WithID(id string) Task
+}
+
+type BreakerTask interface {
+	Task
+	WithBreaker(name string) Task
+}
+
+type ResourceTask interface {
+	Task
+	WithResources(r Resources) Task
+}
+
+type SelectorTask interface {
+	Task
+	WithSelector(s Selector) Task
+}
+
+type CalendarTask interface {
+	Task
+	WithCalendar(c Calendar) Task
+}
+
 type PriorityTask interface {
 	Task
 	WithPriority(int) Task
 }
 
+// TypedTask is a task tells its type, such as the type of the script it runs, the type is
+// the Type of TaskInfo
+type TypedTask interface {
+	Task
+	WithType(typ string) Task
+}
+
 type CallbackFunc func(context.Context) error
 type CallbackTask interface {
 	Task
@@ -66,12 +99,11 @@ func (t TaskFunc) WithRetry(times uint) Task {
 
 // WithTimeout set the timeout for this task
 func (t TaskFunc) WithTimeout(timeout time.Duration) Task {
-	context, cancelFunc := context.WithDeadline(context.Background(), time.Now().Add(timeout))
-	return &task{
-		task:       t,
-		ctx:        context,
-		cancelFunc: cancelFunc,
+	task := &task{
+		task: t,
 	}
+
+	return task.WithTimeout(timeout)
 }
 
 // WithCancelFunc returns the cancel function for this task
@@ -85,6 +117,70 @@ func (t TaskFunc) WithCancelFunc(timeout time.Duration) (Task, context.CancelFun
 	}, cancelFunc
 }
 
+// WithID set the id for this task, an id is generated when it's scheduled without one
+func (t TaskFunc) WithID(id string) Task {
+	return &task{
+		task: t,
+		id:   id,
+	}
+}
+
+// WithBreaker guards this task by the circuit breaker named name
+func (t TaskFunc) WithBreaker(name string) Task {
+	return &task{
+		task:    t,
+		breaker: name,
+	}
+}
+
+// WithResources set the resources this task needs to run
+func (t TaskFunc) WithResources(r Resources) Task {
+	return &task{
+		task:      t,
+		resources: r,
+	}
+}
+
+// WithSelector set the selector chooses the workers this task may run on
+func (t TaskFunc) WithSelector(s Selector) Task {
+	return &task{
+		task:     t,
+		selector: s,
+	}
+}
+
+// WithDeadline set the time this task must finish by
+func (t TaskFunc) WithDeadline(deadline time.Time) Task {
+	return &task{
+		task:     t,
+		deadline: deadline,
+	}
+}
+
+// OnDeadlineMiss add the func called when this task misses its deadline
+func (t TaskFunc) OnDeadlineMiss(f MissFunc) Task {
+	return &task{
+		task:      t,
+		missFuncs: []MissFunc{f},
+	}
+}
+
+// WithTTL set how long this task may wait to start before it expires
+func (t TaskFunc) WithTTL(ttl time.Duration) Task {
+	return &task{
+		task: t,
+		ttl:  ttl,
+	}
+}
+
+// WithCalendar set the calendar decides when this task may run
+func (t TaskFunc) WithCalendar(c Calendar) Task {
+	return &task{
+		task:     t,
+		calendar: c,
+	}
+}
+
 // WithPriority set the priority for this task
 func (t TaskFunc) WithPriority(priority int) Task {
 	return &task{
@@ -93,28 +189,63 @@ func (t TaskFunc) WithPriority(priority int) Task {
 	}
 }
 
+// WithType set the type of this task
+func (t TaskFunc) WithType(typ string) Task {
+	return &task{
+		task: t,
+		typ:  typ,
+	}
+}
+
 // AddStartCallback add the start callback func to this task
 func (t TaskFunc) AddStartCallback(f CallbackFunc) Task {
-	return &task{
-		task:          t,
-		startCallBack: []CallbackFunc{f},
+	task := &task{
+		task: t,
 	}
+
+	return task.AddStartCallback(f)
 }
 
 // AddFinishedCallback add the finished callback func to this task
 func (t TaskFunc) AddFinishedCallback(f CallbackFunc) Task {
+	task := &task{
+		task: t,
+	}
+
+	return task.AddFinishedCallback(f)
+}
+
+// Use adds middleware to this task
+func (t TaskFunc) Use(mw ...Middleware) Task {
+	return &task{
+		task:       t,
+		middleware: mw,
+	}
+}
+
+// OnOutcome add the func called with the outcome of this task
+func (t TaskFunc) OnOutcome(f OutcomeFunc) Task {
+	return &task{
+		task:         t,
+		outcomeFuncs: []OutcomeFunc{f},
+	}
+}
+
+// OnRetry add the func called after a failed attempt of this task will be retried
+func (t TaskFunc) OnRetry(f OutcomeFunc) Task {
 	return &task{
-		task:             t,
-		finishedCallBack: []CallbackFunc{f},
+		task:       t,
+		retryFuncs: []OutcomeFunc{f},
 	}
 }
 
 // BindScheduler bind the scheduler with this task, this shouldn't called by user
 func (t TaskFunc) BindScheduler(s *Scheduler) Task {
-	return &task{
+	task := &task{
 		task: t,
-		sche: s,
 	}
+
+	return task.BindScheduler(s)
 }
 
 // SetContext set the context for this task, the context will used when call the internal function
@@ -127,20 +258,63 @@ func (t TaskFunc) SetContext(ctx context.Context) Task {
 
 // task is the implement for Task
 type task struct {
+	id         string
 	task       Task
 	ctx        context.Context
 	cancelFunc context.CancelFunc
+	// cancel cancels ctx, which is derived from parent when the task is scheduled
+	cancel context.CancelFunc
+	parent context.Context
 
 	sche *Scheduler
 
 	catchFunc  CatchFunc
 	retryTimes uint
-	timeout    time.Duration
-	deadline   time.Time
-	priority   int
-
-	startCallBack    []CallbackFunc
-	finishedCallBack []CallbackFunc
+	attempts   uint
+	breaker    string
+	resources  Resources
+	selector   Selector
+	calendar   Calendar
+	// generated means the id is given by the scheduler, it isn't kept over restarts
+	generated bool
+	// skips counts the times the task is overtaken while waiting for resources, the
+	// stealing workers scan the queue at the same time, so it's accessed atomically
+	skips int64
+	// missed is set once the task is reported missing its deadline
+	missed    int32
+	missTimer Timer
+	missFuncs []MissFunc
+	// expireAt is when the task expires if it hasn't started, set from ttl when it's scheduled
+	ttl         time.Duration
+	expireAt    time.Time
+	expireTimer Timer
+	// queuedAt is the unix nano time the task was last put into the queue
+	queuedAt int64
+	// qstate is the state of the task in a stealingQueue
+	qstate   int32
+	timeout  time.Duration
+	deadline time.Time
+	priority int
+	// typ is the type set by WithType, the type is told by what the task wraps without it
+	typ string
+
+	// spec is the TaskSpec the task is submitted by, nil if it isn't
+	spec *TaskSpec
+
+	// parentTask is the task spawned this one, children are the ones it spawned and not
+	// completed yet
+	parentTask *task
+	childMu    sync.Mutex
+	children   []*task
+	childErr   error
+	childIdle  chan struct{}
+	// childCancelled is set once the children are cancelled, no child is added after it
+	childCancelled bool
+
+	// middleware has the callbacks too, so that they run in the order they are added
+	middleware   []Middleware
+	outcomeFuncs []OutcomeFunc
+	retryFuncs   []OutcomeFunc
 }
 
 // NewTask return a task
@@ -163,40 +337,29 @@ func (t *task) WithCatch(f CatchFunc) Task {
 
 // WithRetry set the retry times for this task
 func (t *task) WithRetry(times uint) Task {
-	counter, originTask := uint(0), t.task
-
 	t.retryTimes = times
-	t.task = TaskFunc(func(ctx context.Context) error {
-		err := originTask.Do(ctx)
-		if err == nil {
-			return nil
-		}
-
-		log.Printf("[Task] error: %s", err)
-		if counter < times {
-			counter++
-			log.Printf("[Task] Retry times: %d", counter)
-			t.sche.queue.Add(t)
-		}
-
-		return nil
-	})
+	return t
+}
 
+// WithID set the id for this task, an id is generated when it's scheduled without one
+func (t *task) WithID(id string) Task {
+	t.id = id
 	return t
 }
 
-// WithTimeout set the timeout for this task
-func (t *task) WithTimeout(timeout time.Duration) Task {
-	backgroundContext := context.Background()
-	if t.ctx != nil {
-		backgroundContext = t.ctx
-	}
-	t.deadline = time.Now().Add(timeout)
-	context, cancelFunc := context.WithDeadline(backgroundContext, t.deadline)
+// WithBreaker guards this task by the circuit breaker named name
+func (t *task) WithBreaker(name string) Task {
+	t.breaker = name
+	return t
+}
 
-	t.ctx = context
-	t.cancelFunc = cancelFunc
+// WithTimeout set the timeout for this task, the deadline is counted from the time it's scheduled
+func (t *task) WithTimeout(timeout time.Duration) Task {
 	t.timeout = timeout
+	t.deadline = time.Time{}
+	if t.sche != nil {
+		t.deadline = t.sche.clock.Now().Add(timeout)
+	}
 
 	return t
 }
@@ -214,43 +377,133 @@ func (t *task) WithCancelFunc(timeout time.Duration) (Task, context.CancelFunc)
 	return t, cancelFunc
 }
 
+// WithResources set the resources this task needs to run
+func (t *task) WithResources(r Resources) Task {
+	t.resources = r
+	return t
+}
+
+// WithSelector set the selector chooses the workers this task may run on
+func (t *task) WithSelector(s Selector) Task {
+	t.selector = s
+	return t
+}
+
+// WithDeadline set the time this task must finish by, it replaces the timeout
+func (t *task) WithDeadline(deadline time.Time) Task {
+	t.timeout = 0
+	t.deadline = deadline
+	return t
+}
+
+// OnDeadlineMiss add the func called when this task misses its deadline
+func (t *task) OnDeadlineMiss(f MissFunc) Task {
+	t.missFuncs = append(t.missFuncs, f)
+	return t
+}
+
+// WithTTL set how long this task may wait to start before it expires, counted from the time
+// it's scheduled
+func (t *task) WithTTL(ttl time.Duration) Task {
+	t.ttl = ttl
+	t.expireAt = time.Time{}
+	if t.sche != nil {
+		t.expireAt = t.sche.clock.Now().Add(ttl)
+	}
+
+	return t
+}
+
+// WithCalendar set the calendar decides when this task may run
+func (t *task) WithCalendar(c Calendar) Task {
+	t.calendar = c
+	return t
+}
+
 // WithPriority set the priority for this task
 func (t *task) WithPriority(priority int) Task {
 	t.priority = priority
 	return t
 }
 
+// WithType set the type of this task
+func (t *task) WithType(typ string) Task {
+	t.typ = typ
+	return t
+}
+
 // AddStartCallback add the start callback func to this task
 func (t *task) AddStartCallback(f CallbackFunc) Task {
-	t.startCallBack = append(t.startCallBack, f)
+	t.middleware = append(t.middleware, t.startCallback(f))
 	return t
 }
 
 // AddFinishedCallback add the finished callback func to this task
 func (t *task) AddFinishedCallback(f CallbackFunc) Task {
-	t.finishedCallBack = append(t.finishedCallBack, f)
+	t.middleware = append(t.middleware, t.finishedCallback(f))
+	return t
+}
+
+// Use adds middleware to this task
+func (t *task) Use(mw ...Middleware) Task {
+	t.middleware = append(t.middleware, mw...)
+	return t
+}
+
+// OnOutcome add the func called with the outcome of this task
+func (t *task) OnOutcome(f OutcomeFunc) Task {
+	t.outcomeFuncs = append(t.outcomeFuncs, f)
+	return t
+}
+
+// OnRetry add the func called after a failed attempt of this task will be retried
+func (t *task) OnRetry(f OutcomeFunc) Task {
+	t.retryFuncs = append(t.retryFuncs, f)
 	return t
 }
 
 // BindScheduler bind the scheduler with this task, this shouldn't called by user
 func (t *task) BindScheduler(s *Scheduler) Task {
 	t.sche = s
+	if t.id == "" {
+		t.id = s.nextID()
+		t.generated = true
+	}
+	if t.timeout > 0 && t.deadline.IsZero() {
+		t.deadline = s.clock.Now().Add(t.timeout)
+	}
+	if t.ttl > 0 && t.expireAt.IsZero() {
+		t.expireAt = s.clock.Now().Add(t.ttl)
+	}
+
 	return t
 }
 
 // SetContext set the context for this task, the context will used when call the internal function
 func (t *task) SetContext(ctx context.Context) Task {
 	if t.ctx != nil && t.ctx != ctx {
-		log.Printf("[Warning] don't have the same context, use the lastest")
+		t.logger().Warn("don't have the same context, use the lastest")
 	}
 
 	t.ctx = ctx
 	return t
 }
 
+// logger returns the logger of the bound scheduler
+func (t *task) logger() Logger {
+	if t.sche == nil {
+		return defaultLogger
+	}
+
+	return t.sche.logger
+}
+
 type JsTask struct {
-	script string
-	vm     *otto.Otto
+	script    string
+	vm        *otto.Otto
+	output    io.Writer
+	errOutput io.Writer
+	host      HostAPI
 }
 
 func NewJsTask(script string) *JsTask {
@@ -264,15 +517,6 @@ func (t *JsTask) SetParam(name string, value interface{}) error {
 	return t.vm.Set(name, value)
 }
 
-func (s *JsTask) Do(context.Context) error {
-	_, err := s.vm.Run(s.script)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // WithCatch set the catch function for this task
 func (t *JsTask) WithCatch(f CatchFunc) Task {
 	return &task{
@@ -292,12 +536,11 @@ func (t *JsTask) WithRetry(times uint) Task {
 
 // WithTimeout set the timeout for this task
 func (t *JsTask) WithTimeout(timeout time.Duration) Task {
-	context, cancelFunc := context.WithDeadline(context.Background(), time.Now().Add(timeout))
-	return &task{
-		task:       t,
-		ctx:        context,
-		cancelFunc: cancelFunc,
+	task := &task{
+		task: t,
 	}
+
+	return task.WithTimeout(timeout)
 }
 
 // WithCancelFunc returns the cancel function for this task
@@ -311,6 +554,70 @@ func (t *JsTask) WithCancelFunc(timeout time.Duration) (Task, context.CancelFunc
 	}, cancelFunc
 }
 
+// WithID set the id for this task, an id is generated when it's scheduled without one
+func (t *JsTask) WithID(id string) Task {
+	return &task{
+		task: t,
+		id:   id,
+	}
+}
+
+// WithBreaker guards this task by the circuit breaker named name
+func (t *JsTask) WithBreaker(name string) Task {
+	return &task{
+		task:    t,
+		breaker: name,
+	}
+}
+
+// WithResources set the resources this task needs to run
+func (t *JsTask) WithResources(r Resources) Task {
+	return &task{
+		task:      t,
+		resources: r,
+	}
+}
+
+// WithSelector set the selector chooses the workers this task may run on
+func (t *JsTask) WithSelector(s Selector) Task {
+	return &task{
+		task:     t,
+		selector: s,
+	}
+}
+
+// WithDeadline set the time this task must finish by
+func (t *JsTask) WithDeadline(deadline time.Time) Task {
+	return &task{
+		task:     t,
+		deadline: deadline,
+	}
+}
+
+// OnDeadlineMiss add the func called when this task misses its deadline
+func (t *JsTask) OnDeadlineMiss(f MissFunc) Task {
+	return &task{
+		task:      t,
+		missFuncs: []MissFunc{f},
+	}
+}
+
+// WithTTL set how long this task may wait to start before it expires
+func (t *JsTask) WithTTL(ttl time.Duration) Task {
+	return &task{
+		task: t,
+		ttl:  ttl,
+	}
+}
+
+// WithCalendar set the calendar decides when this task may run
+func (t *JsTask) WithCalendar(c Calendar) Task {
+	return &task{
+		task:     t,
+		calendar: c,
+	}
+}
+
 // WithPriority set the priority for this task
 func (t *JsTask) WithPriority(priority int) Task {
 	return &task{
@@ -319,28 +626,63 @@ func (t *JsTask) WithPriority(priority int) Task {
 	}
 }
 
+// WithType set the type of this task
+func (t *JsTask) WithType(typ string) Task {
+	return &task{
+		task: t,
+		typ:  typ,
+	}
+}
+
 // AddStartCallback add the start callback func to this task
 func (t *JsTask) AddStartCallback(f CallbackFunc) Task {
-	return &task{
-		task:          t,
-		startCallBack: []CallbackFunc{f},
+	task := &task{
+		task: t,
 	}
+
+	return task.AddStartCallback(f)
 }
 
 // AddFinishedCallback add the finished callback func to this task
 func (t *JsTask) AddFinishedCallback(f CallbackFunc) Task {
+	task := &task{
+		task: t,
+	}
+
+	return task.AddFinishedCallback(f)
+}
+
+// Use adds middleware to this task
+func (t *JsTask) Use(mw ...Middleware) Task {
+	return &task{
+		task:       t,
+		middleware: mw,
+	}
+}
+
+// OnOutcome add the func called with the outcome of this task
+func (t *JsTask) OnOutcome(f OutcomeFunc) Task {
+	return &task{
+		task:         t,
+		outcomeFuncs: []OutcomeFunc{f},
+	}
+}
+
+// OnRetry add the func called after a failed attempt of this task will be retried
+func (t *JsTask) OnRetry(f OutcomeFunc) Task {
 	return &task{
-		task:             t,
-		finishedCallBack: []CallbackFunc{f},
+		task:       t,
+		retryFuncs: []OutcomeFunc{f},
 	}
 }
 
 // BindScheduler bind the scheduler with this task, this shouldn't called by user
 func (t *JsTask) BindScheduler(s *Scheduler) Task {
-	return &task{
+	task := &task{
 		task: t,
-		sche: s,
 	}
+
+	return task.BindScheduler(s)
 }
 
 // SetContext set the context for this task, the context will used when call the internal function
@@ -1,6 +1,11 @@
 package scheduler
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
 
 type Worker interface {
 	Work()
@@ -8,85 +13,240 @@ type Worker interface {
 
 // Worker represents a working goroutine.
 type goroutineWorker struct {
+	id     string
 	sche   *Scheduler
 	task   chan Task
 	stopCh chan struct{}
+	labels Labels
 }
 
 func NewGoroutineWorker(s *Scheduler, stopCh chan struct{}) Worker {
+	return NewLabeledWorker(s, stopCh, nil)
+}
+
+// NewLabeledWorker returns a goroutine worker carries labels, only the tasks whose selector
+// matches the labels are sent to it
+func NewLabeledWorker(s *Scheduler, stopCh chan struct{}, labels Labels) Worker {
 	return &goroutineWorker{
+		id:     s.nextWorkerID(),
 		sche:   s,
 		task:   make(chan Task),
 		stopCh: stopCh,
+		labels: labels,
 	}
 }
 
 // StartWorker create a new worker.
 func (s *Scheduler) startWorker(stopCh chan struct{}) {
-	worker := NewGoroutineWorker(s, stopCh)
+	worker := s.workerFactory(s, stopCh)
 
 	go worker.Work()
 }
 
 // Worker's main loop.
 func (w *goroutineWorker) Work() {
-	w.sche.workers <- w.task
+	if q, ok := w.sche.queue.(*stealingQueue); ok {
+		w.steal(q)
+		return
+	}
+
+	w.sche.workers <- w
 
 	for {
 		select {
 		case t := <-w.task:
-			realTask := t.(*task)
-
-			defer func() {
-				if r := recover(); r != nil {
-					realTask.sche.queue.Done(t)
-					return
-				}
-			}()
-
-			select {
-			case <-realTask.ctx.Done():
-				realTask.sche.queue.Done(t)
-				realTask.cancelFunc()
-				if realTask.catchFunc != nil {
-					realTask.catchFunc(errors.New("Task cancel"))
-					break
-				}
+			w.process(t)
+
+			w.sche.workers <- w
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// steal is the main loop in the work-stealing mode, the worker takes tasks from the queue by
+// itself and parks when none of them can run on it
+func (w *goroutineWorker) steal(q *stealingQueue) {
+	q.register()
+	wake := make(chan struct{}, 1)
+	get := func() (Task, bool) {
+		return q.TryGet(w.sche.acceptor(func(t *task) bool {
+			return t.selector.Matches(w.labels)
+		}))
+	}
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		default:
+		}
+
+		t, ok := get()
+		if !ok {
+			t, ok = q.park(wake, get)
+		}
+
+		if ok {
+			w.process(t)
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// process runs a task, a crashed task won't take the worker down with it
+func (w *goroutineWorker) process(t Task) {
+	realTask := t.(*task)
+	defer realTask.sche.queue.Done(t)
+	defer realTask.sche.release(realTask.resources)
+
+	defer func() {
+		if r := recover(); r != nil {
+			w.sche.logger.Error("task panic", "panic", r)
+		}
+	}()
+
+	select {
+	case <-realTask.ctx.Done():
+		if realTask.cancelFunc != nil {
+			realTask.cancelFunc()
+		}
+		realTask.complete(Outcome{Err: ErrCancelled, Attempt: realTask.attempts, Reason: ErrCancelled})
+		return
+	default:
+	}
+
+	if w.sche.expired(realTask) {
+		w.sche.expire(realTask)
+		return
+	}
+	w.sche.started(realTask)
+
+	ctx := realTask.ctx
+	var timedOut int32
+	if !realTask.deadline.IsZero() {
+		remain := realTask.deadline.Sub(w.sche.clock.Now())
+		if remain <= 0 {
+			// a task out of time never runs, the miss policies are for the ones with deadlines
+			if realTask.hasDeadline() {
+				w.sche.missed(realTask, false)
+			}
+			if !realTask.hasDeadline() || w.sche.missPolicy != MissNotify {
+				realTask.complete(Outcome{
+					Err:     context.DeadlineExceeded,
+					Attempt: realTask.attempts,
+					Reason:  context.DeadlineExceeded,
+				})
 				return
-			default:
 			}
+			// a late task let through by MissNotify runs without a timeout
+		} else {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel()
 
-			for _, f := range realTask.startCallBack {
-				if err := f(realTask.ctx); err != nil {
-					if realTask.catchFunc != nil {
-						realTask.catchFunc(err)
-						break
-					}
-				}
-			}
+			timer := w.sche.clock.AfterFunc(remain, func() {
+				atomic.StoreInt32(&timedOut, 1)
+				cancel()
+			})
+			defer timer.Stop()
+		}
+	}
 
-			if err := realTask.Do(realTask.ctx); err != nil {
-				if realTask.catchFunc != nil {
-					realTask.catchFunc(err)
-					break
-				}
+	var breaker *Breaker
+	if realTask.breaker != "" {
+		breaker = w.sche.Breaker(realTask.breaker)
+		if !breaker.allowOrHold(realTask) {
+			if !breaker.config.Hold {
+				realTask.complete(Outcome{Err: ErrBreakerOpen, Attempt: realTask.attempts, Reason: ErrBreakerOpen})
 			}
+			return
+		}
+	}
+
+	ctx, e := w.sche.begin(ctx, realTask, w.id)
+	defer w.sche.end(realTask)
 
-			realTask.sche.queue.Done(t)
-			for _, f := range realTask.finishedCallBack {
-				if err := f(realTask.ctx); err != nil {
-					if realTask.catchFunc != nil {
-						realTask.catchFunc(err)
-						break
-					}
-				}
+	err := w.do(ctx, realTask, TaskInfo{
+		ID:       realTask.id,
+		ParentID: realTask.parentID(),
+		Type:     taskType(realTask),
+		Attempt:  realTask.attempts,
+		Queue:    w.sche.name,
+		Priority: realTask.priority,
+		Breaker:  realTask.breaker,
+		Labels:   w.labels,
+	})
+	w.sche.observeRun(w.sche.clock.Now().Sub(e.start))
 
+	e.mu.Lock()
+	o := Outcome{
+		Err:     err,
+		Result:  e.result,
+		Attempt: e.attempt,
+		Start:   e.start,
+		End:     w.sche.clock.Now(),
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		switch {
+		case atomic.LoadInt32(&timedOut) == 1:
+			o.Reason = context.DeadlineExceeded
+			if realTask.hasDeadline() {
+				w.sche.missed(realTask, true)
 			}
+		case realTask.ctx.Err() != nil:
+			o.Reason = ErrCancelled
+		}
+	}
 
-			w.sche.workers <- w.task
-		case <-w.stopCh:
-			close(w.task)
+	// a cancelled task tells nothing about the health of what the breaker guards
+	if breaker != nil {
+		if errors.Is(o.Reason, ErrCancelled) {
+			breaker.forget()
+		} else {
+			breaker.record(err)
+		}
+	}
+
+	if err != nil {
+		w.sche.logger.Warn("task failed", "error", err)
+		if o.Reason == nil && realTask.attempts < realTask.retryTimes {
+			realTask.attempts++
+			realTask.retry(o)
+			w.sche.logger.Info("retry task", "times", realTask.attempts)
+			if err := w.sche.enqueue(context.Background(), realTask); err != nil {
+				// the task can't be queued again, so the failure is its outcome
+				w.sche.logger.Error("retry task failed", "error", err)
+				o.Err, o.Reason = err, err
+				realTask.complete(o)
+			}
 			return
 		}
 	}
+
+	realTask.complete(o)
+}
+
+// do calls the task through the middleware, a panic is turned into an error
+func (w *goroutineWorker) do(ctx context.Context, t *task, info TaskInfo) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panic: %v", r)
+		}
+	}()
+
+	// the faults are injected right around the task, as if it failed by itself
+	h := chain(w.sche.faults.middleware(func(ctx context.Context, info TaskInfo) error {
+		return t.Do(ctx)
+	}), t.middleware)
+
+	return chain(h, w.sche.middleware)(ctx, info)
 }
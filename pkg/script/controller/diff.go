@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of the unchanged lines around the changes of a hunk
+const diffContext = 3
+
+// maxDiffCells bounds the table of the longest common subsequence of two scripts
+const maxDiffCells = 4 << 20
+
+// errDiffTooLarge is returned when two scripts are too long to be diffed
+var errDiffTooLarge = errors.New("scripts are too large to diff")
+
+// diffLine is a line of a diff, op is ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+	// a and b are the line numbers in the old and the new script, from 0
+	a, b int
+}
+
+// unifiedDiff returns the unified diff of the lines of from and to
+func unifiedDiff(fromName, toName, from, to string) (string, error) {
+	lines, err := diffLines(splitLines(from), splitLines(to))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// a hunk starts with the context before the change, and goes on while the next
+		// change is close enough to share the context
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = next
+		}
+
+		hunk := lines[start:end]
+		aStart, bStart, aCount, bCount := hunk[0].a, hunk[0].b, 0, 0
+		for _, l := range hunk {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, l := range hunk {
+			sb.WriteByte(l.op)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+
+		i = end
+	}
+
+	return sb.String(), nil
+}
+
+// hunkRange formats the start and the count of a hunk, the start is from 1 unless the
+// range is empty
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffLines returns the edit from a to b by their longest common subsequence
+func diffLines(a, b []string) ([]diffLine, error) {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return nil, errDiffTooLarge
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{op: ' ', text: a[i], a: i, b: j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{op: '-', text: a[i], a: i, b: j})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: b[j], a: i, b: j})
+			j++
+		}
+	}
+
+	return lines, nil
+}
+
+// splitLines splits s into lines without the trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
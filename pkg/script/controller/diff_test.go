@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int, replace map[int]string) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			if s, ok := replace[i]; ok {
+				sb.WriteString(s + "\n")
+				continue
+			}
+			sb.WriteString(strconv.Itoa(i) + "\n")
+		}
+		return sb.String()
+	}
+
+	cases := []struct {
+		name     string
+		from, to string
+		diff     string
+	}{
+		{
+			name: "empty",
+			diff: "",
+		},
+		{
+			name: "same",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			diff: "",
+		},
+		{
+			name: "from empty",
+			to:   "a\n",
+			diff: "@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name: "to empty",
+			from: "a\nb\n",
+			diff: "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "insert at top",
+			from: "b\nc\n",
+			to:   "a\nb\nc\n",
+			diff: "@@ -1,2 +1,3 @@\n+a\n b\n c\n",
+		},
+		{
+			name: "delete at end",
+			from: "a\nb\nc\n",
+			to:   "a\nb\n",
+			diff: "@@ -1,3 +1,2 @@\n a\n b\n-c\n",
+		},
+		{
+			name: "hunks merge",
+			from: lines(1, 10, nil),
+			to:   lines(1, 10, map[int]string{2: "two", 8: "eight"}),
+			diff: "@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n",
+		},
+		{
+			name: "hunks apart",
+			from: lines(1, 15, nil),
+			to:   lines(1, 15, map[int]string{1: "one", 12: "twelve"}),
+			diff: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,7 +9,7 @@\n 9\n 10\n 11\n-12\n+twelve\n 13\n 14\n 15\n",
+		},
+	}
+
+	for _, c := range cases {
+		diff, err := unifiedDiff("v1", "v2", c.from, c.to)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if expected := "--- v1\n+++ v2\n" + c.diff; diff != expected {
+			t.Errorf("%s: diff is expected as\n%s\nactually\n%s", c.name, expected, diff)
+		}
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	cases := []struct {
+		start, count int
+		expected     string
+	}{
+		{0, 0, "0,0"},
+		{3, 0, "3,0"},
+		{0, 1, "1"},
+		{4, 1, "5"},
+		{0, 3, "1,3"},
+		{8, 7, "9,7"},
+	}
+
+	for _, c := range cases {
+		if r := hunkRange(c.start, c.count); r != c.expected {
+			t.Errorf("range of %d,%d is expected as %q, actually %q", c.start, c.count, c.expected, r)
+		}
+	}
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	large := strings.Repeat("a\n", 4096)
+	if _, err := unifiedDiff("v1", "v2", large, large+"b\n"); err != errDiffTooLarge {
+		t.Errorf("error is expected as %v, actually %v", errDiffTooLarge, err)
+	}
+}
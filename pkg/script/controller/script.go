@@ -1,21 +1,33 @@
 package controller
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/silverswords/cerebus/pkg/script/model"
+	"github.com/silverswords/cerebus/pkg/script/runner"
 )
 
+// validateTimeout bounds the validation of a script
+const validateTimeout = 10 * time.Second
+
 type Scripscontroller struct {
-	db *sql.DB
+	db      *sql.DB
+	runners *runner.Registry
 }
 
-func New(db *sql.DB) *Scripscontroller {
+func New(db *sql.DB, runners *runner.Registry) *Scripscontroller {
 	return &Scripscontroller{
-		db: db,
+		db:      db,
+		runners: runners,
 	}
 }
 
@@ -30,16 +42,33 @@ func (sc *Scripscontroller) RegisterRouter(r gin.IRouter) {
 		return
 	}
 
+	if err := model.CreateKVTable(sc.db); err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	if err := model.CreateVersionTable(sc.db); err != nil {
+		log.Fatal(err)
+		return
+	}
+
 	r.POST("/add", sc.addScript)
 	r.POST("/script/update", sc.updateScript)
+	r.POST("/script/capabilities", sc.updateCapabilities)
+	r.POST("/script/rollback", sc.rollback)
 
 	r.GET("/script", sc.getScript)
+	r.GET("/script/types", sc.getTypes)
+	r.GET("/script/versions", sc.getVersions)
+	r.GET("/script/diff", sc.diff)
 }
 
 func (sc *Scripscontroller) addScript(c *gin.Context) {
 	var req struct {
 		Name string `json:"name,omitempty" binding:"required"`
 		Type string `json:"type,omitempty" binding:"required"`
+		// Capabilities are the host API granted to the script when it's embedded
+		Capabilities []string `json:"capabilities,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -48,7 +77,19 @@ func (sc *Scripscontroller) addScript(c *gin.Context) {
 		return
 	}
 
-	if err := model.InsertScript(sc.db, req.Name, req.Type); err != nil {
+	if _, err := sc.runners.Runner(req.Type); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if err := checkCapabilities(req.Capabilities); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if err := model.InsertScript(sc.db, req.Name, req.Type, req.Capabilities); err != nil {
 		c.Error(err)
 		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
 		return
@@ -61,6 +102,171 @@ func (sc *Scripscontroller) updateScript(c *gin.Context) {
 	var req struct {
 		ID     uint32 `json:"id,omitempty" binding:"required"`
 		Script string `json:"script,omitempty" binding:"required"`
+		Author string `json:"author,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	script, err := model.SelectScriptByID(sc.db, req.ID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	sc.saveVersion(c, script, req.Script, req.Author)
+}
+
+// saveVersion validates source with the runner of script and saves it as a new version of
+// script. The source is saved even if it's invalid, so that it can be fixed, but it can't run.
+// It's saved unvalidated if the validator isn't available.
+func (sc *Scripscontroller) saveVersion(c *gin.Context, script *model.Script, source string, author string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), validateTimeout)
+	defer cancel()
+
+	validated := true
+	problems, err := sc.runners.Validate(ctx, script.Type, unescape(source))
+	if errors.Is(err, runner.ErrNoValidator) {
+		log.Printf("script %d is saved unvalidated: %v\n", script.ID, err)
+		validated, err = false, nil
+	}
+	if err != nil {
+		c.Error(err)
+		if errors.Is(err, runner.ErrUnknownType) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+			return
+		}
+
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	var data json.RawMessage
+	if len(problems) > 0 {
+		if data, err = json.Marshal(problems); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+			return
+		}
+	}
+
+	version, err := model.UpdateScriptByID(sc.db, script.ID, source, author, len(problems) == 0, validated, data)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "version": version, "valid": len(problems) == 0, "validated": validated, "problems": problems})
+}
+
+func (sc *Scripscontroller) getVersions(c *gin.Context) {
+	var req struct {
+		ID uint32 `form:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	versions, err := model.SelectVersions(sc.db, req.ID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "versions": versions})
+}
+
+func (sc *Scripscontroller) diff(c *gin.Context) {
+	var req struct {
+		ID   uint32 `form:"id" binding:"required"`
+		From int    `form:"from" binding:"required"`
+		To   int    `form:"to" binding:"required"`
+	}
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	var versions [2]*model.Version
+	for i, version := range []int{req.From, req.To} {
+		v, err := model.SelectVersion(sc.db, req.ID, version)
+		if err != nil {
+			c.Error(err)
+			if errors.Is(err, model.ErrVersionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+				return
+			}
+
+			c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+			return
+		}
+
+		versions[i] = v
+	}
+
+	diff, err := unifiedDiff(fmt.Sprintf("v%d", req.From), fmt.Sprintf("v%d", req.To),
+		unescape(versions[0].Script), unescape(versions[1].Script))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "diff": diff})
+}
+
+func (sc *Scripscontroller) rollback(c *gin.Context) {
+	var req struct {
+		ID      uint32 `json:"id,omitempty" binding:"required"`
+		Version int    `json:"version,omitempty" binding:"required"`
+		Author  string `json:"author,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	script, err := model.SelectScriptByID(sc.db, req.ID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	v, err := model.SelectVersion(sc.db, req.ID, req.Version)
+	if err != nil {
+		c.Error(err)
+		if errors.Is(err, model.ErrVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+			return
+		}
+
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	// the content of the version is saved as a new version, so the history is kept, and it's
+	// validated again since the runner may have changed since then
+	sc.saveVersion(c, script, v.Script, req.Author)
+}
+
+func (sc *Scripscontroller) updateCapabilities(c *gin.Context) {
+	var req struct {
+		ID           uint32   `json:"id,omitempty" binding:"required"`
+		Capabilities []string `json:"capabilities"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -69,7 +275,13 @@ func (sc *Scripscontroller) updateScript(c *gin.Context) {
 		return
 	}
 
-	if err := model.UpdateScriptByID(sc.db, req.ID, req.Script); err != nil {
+	if err := checkCapabilities(req.Capabilities); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if err := model.UpdateCapabilities(sc.db, req.ID, req.Capabilities); err != nil {
 		c.Error(err)
 		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
 		return
@@ -89,6 +301,10 @@ func (sc *Scripscontroller) getScript(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "script": scripts})
 }
 
+func (sc *Scripscontroller) getTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "types": sc.runners.Types()})
+}
+
 func (sc *Scripscontroller) deleteScript(c *gin.Context) {
 	var req struct {
 		ID uint32
@@ -108,3 +324,32 @@ func (sc *Scripscontroller) deleteScript(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
 }
+
+// checkCapabilities returns an error if a capability is unknown
+func checkCapabilities(capabilities []string) error {
+	for _, name := range capabilities {
+		known := false
+		for _, c := range model.Capabilities {
+			if c == name {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return fmt.Errorf("unknown capability %q", name)
+		}
+	}
+
+	return nil
+}
+
+// unescape returns the script as it's run, the scripts are stored escaped
+func unescape(script string) string {
+	s, err := url.QueryUnescape(script)
+	if err != nil {
+		return script
+	}
+
+	return s
+}
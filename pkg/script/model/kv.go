@@ -0,0 +1,103 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const KVTableName = "script_kv"
+
+const (
+	postgresKVCreateTable = iota
+	postgresKVGet
+	postgresKVSet
+	postgresKVDelete
+	postgresKVKeys
+)
+
+var kvSQLString = map[int]string{
+	postgresKVCreateTable: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+		script_id INT NOT NULL,
+		key VARCHAR(255) NOT NULL,
+		value TEXT NOT NULL,
+		update_time TIMESTAMP NOT NULL DEFAULT timestamp '2000-01-01 00:00:00',
+		PRIMARY KEY (script_id, key)
+	);`, SchemaName, KVTableName),
+	postgresKVGet: fmt.Sprintf(`SELECT value FROM %s.%s WHERE script_id = $1 AND key = $2`, SchemaName, KVTableName),
+	postgresKVSet: fmt.Sprintf(`INSERT INTO %s.%s (script_id, key, value, update_time) VALUES ($1, $2, $3, current_timestamp)
+		ON CONFLICT (script_id, key) DO UPDATE SET value = EXCLUDED.value, update_time = EXCLUDED.update_time`, SchemaName, KVTableName),
+	postgresKVDelete: fmt.Sprintf(`DELETE FROM %s.%s WHERE script_id = $1 AND key = $2`, SchemaName, KVTableName),
+	postgresKVKeys:   fmt.Sprintf(`SELECT key FROM %s.%s WHERE script_id = $1 ORDER BY key`, SchemaName, KVTableName),
+}
+
+func CreateKVTable(db *sql.DB) error {
+	_, err := db.Exec(kvSQLString[postgresKVCreateTable])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func GetValue(ctx context.Context, db *sql.DB, scriptID uint32, key string) (string, bool, error) {
+	var value string
+	row := db.QueryRowContext(ctx, kvSQLString[postgresKVGet], scriptID, key)
+	if err := row.Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+func SetValue(ctx context.Context, db *sql.DB, scriptID uint32, key string, value string) error {
+	result, err := db.ExecContext(ctx, kvSQLString[postgresKVSet], scriptID, key, value)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid insert")
+	}
+
+	return nil
+}
+
+func DeleteValue(ctx context.Context, db *sql.DB, scriptID uint32, key string) error {
+	_, err := db.ExecContext(ctx, kvSQLString[postgresKVDelete], scriptID, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func SelectKeys(ctx context.Context, db *sql.DB, scriptID uint32) ([]string, error) {
+	rows, err := db.QueryContext(ctx, kvSQLString[postgresKVKeys], scriptID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
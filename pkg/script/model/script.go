@@ -2,19 +2,34 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Script struct {
-	ID         uint32    `json:"id,omitempty"`
-	Name       string    `json:"name,omitempty"`
-	Script     string    `json:"script,omitempty"`
-	Type       string    `json:"type,omitempty"`
-	CreateTime time.Time `json:"create_time,omitempty"`
+	ID           uint32    `json:"id,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	Script       string    `json:"script,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	Capabilities []string  `json:"capabilities"`
+	Version      int       `json:"version"`
+	CreateTime   time.Time `json:"create_time,omitempty"`
 }
 
+// the capabilities of the host API can be granted to the embedded scripts
+const (
+	CapabilityHTTP    = "http"
+	CapabilityKV      = "kv"
+	CapabilityObjects = "objects"
+	CapabilityLog     = "log"
+)
+
+var Capabilities = []string{CapabilityHTTP, CapabilityKV, CapabilityObjects, CapabilityLog}
+
 const (
 	SchemaName = "project"
 	TableName  = "scripts"
@@ -23,11 +38,15 @@ const (
 const (
 	postgresScriptCreateDatabase = iota
 	postgresScriptCreateTable
+	postgresScriptAlterTable
 	postgresScriptRegisterScript
 	postgresScriptSelectAll
 	postgresScriptSelectScriptByID
+	postgresScriptLockScriptByID
 	postgresScriptUpdateScriptByID
 	postgresScriptDeleteScriptByID
+	postgresScriptUpdateCapabilities
+	postgresScriptMigrateTypes
 )
 
 var scriptSQLString = map[int]string{
@@ -37,13 +56,21 @@ var scriptSQLString = map[int]string{
 		name VARCHAR(50) NOT NULL UNIQUE DEFAULT '',
 		script text NOT NULL DEFAULT '',
 		type VARCHAR(20) NOT NULL DEFAULT '',
+		capabilities TEXT[] NOT NULL DEFAULT '{}',
+		version INT NOT NULL DEFAULT 0,
 		create_time timestamp NOT NULL DEFAULT timestamp '2000-01-01 00:00:00'
 	);`, SchemaName, TableName),
-	postgresScriptRegisterScript:   fmt.Sprintf(`INSERT INTO %s.%s (name, type, create_time) VALUES ($1, $2, current_timestamp);`, SchemaName, TableName),
-	postgresScriptSelectAll:        fmt.Sprintf(`SELECT id, name, script, type, create_time FROM %s.%s;`, SchemaName, TableName),
-	postgresScriptSelectScriptByID: fmt.Sprintf(`SELECT id, name, script, type, create_time FROM %s.%s WHERE id = $1;`, SchemaName, TableName),
-	postgresScriptUpdateScriptByID: fmt.Sprintf("UPDATE %s.%s SET script = $1 WHERE id = $2", SchemaName, TableName),
-	postgresScriptDeleteScriptByID: fmt.Sprintf("DELETE FROM %s.%s WHERE id = $1", SchemaName, TableName),
+	postgresScriptAlterTable: fmt.Sprintf(`ALTER TABLE %s.%s
+		ADD COLUMN IF NOT EXISTS capabilities TEXT[] NOT NULL DEFAULT '{}',
+		ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 0;`, SchemaName, TableName),
+	postgresScriptRegisterScript:     fmt.Sprintf(`INSERT INTO %s.%s (name, type, capabilities, create_time) VALUES ($1, $2, $3, current_timestamp);`, SchemaName, TableName),
+	postgresScriptSelectAll:          fmt.Sprintf(`SELECT id, name, script, type, capabilities, version, create_time FROM %s.%s;`, SchemaName, TableName),
+	postgresScriptSelectScriptByID:   fmt.Sprintf(`SELECT id, name, script, type, capabilities, version, create_time FROM %s.%s WHERE id = $1;`, SchemaName, TableName),
+	postgresScriptLockScriptByID:     fmt.Sprintf("SELECT id FROM %s.%s WHERE id = $1 FOR UPDATE", SchemaName, TableName),
+	postgresScriptUpdateScriptByID:   fmt.Sprintf("UPDATE %s.%s SET script = $1, version = $2 WHERE id = $3", SchemaName, TableName),
+	postgresScriptDeleteScriptByID:   fmt.Sprintf("DELETE FROM %s.%s WHERE id = $1", SchemaName, TableName),
+	postgresScriptUpdateCapabilities: fmt.Sprintf("UPDATE %s.%s SET capabilities = $1 WHERE id = $2", SchemaName, TableName),
+	postgresScriptMigrateTypes:       fmt.Sprintf("UPDATE %s.%s SET type = $1 WHERE type = $2", SchemaName, TableName),
 }
 
 func CreateSchema(db *sql.DB) error {
@@ -61,11 +88,50 @@ func CreateTable(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(scriptSQLString[postgresScriptAlterTable])
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func InsertScript(db *sql.DB, name string, scriptType string) error {
-	_, err := db.Exec(scriptSQLString[postgresScriptRegisterScript], name, scriptType)
+// MigrateTypes sets the type of the scripts of each old type in types to the new one, the
+// other scripts are left as they are. It returns the number of the scripts migrated.
+func MigrateTypes(db *sql.DB, types map[string]string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var migrated int64
+	for old, typ := range types {
+		result, err := tx.Exec(scriptSQLString[postgresScriptMigrateTypes], typ, old)
+		if err != nil {
+			return 0, err
+		}
+
+		num, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		migrated += num
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return migrated, nil
+}
+
+func InsertScript(db *sql.DB, name string, scriptType string, capabilities []string) error {
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+
+	_, err := db.Exec(scriptSQLString[postgresScriptRegisterScript], name, scriptType, pq.Array(capabilities))
 	if err != nil {
 		return err
 	}
@@ -77,11 +143,13 @@ func SelectScripts(db *sql.DB) ([]*Script, error) {
 	var (
 		Scripts []*Script
 
-		ID         uint32
-		Name       string
-		Scirpt     string
-		Type       string
-		CreateTime time.Time
+		ID           uint32
+		Name         string
+		Scirpt       string
+		Type         string
+		Capabilities []string
+		Version      int
+		CreateTime   time.Time
 	)
 
 	rows, err := db.Query(scriptSQLString[postgresScriptSelectAll])
@@ -92,16 +160,18 @@ func SelectScripts(db *sql.DB) ([]*Script, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		if err := rows.Scan(&ID, &Name, &Scirpt, &Type, &CreateTime); err != nil {
+		if err := rows.Scan(&ID, &Name, &Scirpt, &Type, pq.Array(&Capabilities), &Version, &CreateTime); err != nil {
 			return nil, err
 		}
 
 		Script := &Script{
-			ID:         ID,
-			Name:       Name,
-			Script:     Scirpt,
-			Type:       Type,
-			CreateTime: CreateTime,
+			ID:           ID,
+			Name:         Name,
+			Script:       Scirpt,
+			Type:         Type,
+			Capabilities: Capabilities,
+			Version:      Version,
+			CreateTime:   CreateTime,
 		}
 
 		Scripts = append(Scripts, Script)
@@ -113,15 +183,47 @@ func SelectScripts(db *sql.DB) ([]*Script, error) {
 func SelectScriptByID(db *sql.DB, id uint32) (*Script, error) {
 	row := db.QueryRow(scriptSQLString[postgresScriptSelectScriptByID], id)
 	script := &Script{}
-	if err := row.Scan(&script.ID, &script.Name, &script.Script, &script.Type, &script.CreateTime); err != nil {
+	if err := row.Scan(&script.ID, &script.Name, &script.Script, &script.Type, pq.Array(&script.Capabilities), &script.Version, &script.CreateTime); err != nil {
 		return nil, err
 	}
 
 	return script, nil
 }
 
-func UpdateScriptByID(db *sql.DB, id uint32, script string) error {
-	result, err := db.Exec(scriptSQLString[postgresScriptUpdateScriptByID], script, id)
+func UpdateScriptByID(db *sql.DB, id uint32, script string, author string, valid bool, validated bool, problems json.RawMessage) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the row is locked so that the versions of a script are numbered one by one
+	var locked uint32
+	if err := tx.QueryRow(scriptSQLString[postgresScriptLockScriptByID], id).Scan(&locked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("invalid update")
+		}
+		return 0, err
+	}
+
+	version, err := insertVersion(tx, id, script, author, valid, validated, problems)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(scriptSQLString[postgresScriptUpdateScriptByID], script, version, id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func DeleteScriptByID(db *sql.DB, id uint32) error {
+	result, err := db.Exec(scriptSQLString[postgresScriptDeleteScriptByID], id)
 	if err != nil {
 		return err
 	}
@@ -132,14 +234,18 @@ func UpdateScriptByID(db *sql.DB, id uint32, script string) error {
 	}
 
 	if num == 0 {
-		return errors.New("invalid update")
+		return errors.New("invalid delete")
 	}
 
 	return nil
 }
 
-func DeleteScriptByID(db *sql.DB, id uint32) error {
-	result, err := db.Exec(scriptSQLString[postgresScriptDeleteScriptByID], id)
+func UpdateCapabilities(db *sql.DB, id uint32, capabilities []string) error {
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+
+	result, err := db.Exec(scriptSQLString[postgresScriptUpdateCapabilities], pq.Array(capabilities), id)
 	if err != nil {
 		return err
 	}
@@ -150,7 +256,7 @@ func DeleteScriptByID(db *sql.DB, id uint32) error {
 	}
 
 	if num == 0 {
-		return errors.New("invalid delete")
+		return errors.New("invalid update")
 	}
 
 	return nil
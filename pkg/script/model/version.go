@@ -0,0 +1,134 @@
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const VersionTableName = "script_versions"
+
+var ErrVersionNotFound = errors.New("script version not found")
+
+// Version is a content of a script, the versions of a script are numbered from 1. Valid is
+// false if the content has failed the validation of its runner, with the Problems found.
+// Validated is false if the runner couldn't check it, such as its validator isn't installed,
+// such a version is valid until it's proved otherwise.
+type Version struct {
+	ScriptID   uint32          `json:"script_id"`
+	Version    int             `json:"version"`
+	Script     string          `json:"script,omitempty"`
+	Hash       string          `json:"hash"`
+	Author     string          `json:"author"`
+	Valid      bool            `json:"valid"`
+	Validated  bool            `json:"validated"`
+	Problems   json.RawMessage `json:"problems,omitempty"`
+	CreateTime time.Time       `json:"create_time,omitempty"`
+}
+
+const (
+	postgresVersionCreateTable = iota
+	postgresVersionAlterTable
+	postgresVersionInsert
+	postgresVersionSelectAll
+	postgresVersionSelect
+)
+
+var versionSQLString = map[int]string{
+	postgresVersionCreateTable: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+		script_id INT NOT NULL,
+		version INT NOT NULL,
+		script TEXT NOT NULL DEFAULT '',
+		hash VARCHAR(64) NOT NULL,
+		author VARCHAR(50) NOT NULL DEFAULT '',
+		valid BOOLEAN NOT NULL DEFAULT TRUE,
+		validated BOOLEAN NOT NULL DEFAULT TRUE,
+		problems TEXT NOT NULL DEFAULT '',
+		create_time TIMESTAMP NOT NULL DEFAULT timestamp '2000-01-01 00:00:00',
+		PRIMARY KEY (script_id, version)
+	);`, SchemaName, VersionTableName),
+	postgresVersionAlterTable: fmt.Sprintf(`ALTER TABLE %s.%s
+		ADD COLUMN IF NOT EXISTS valid BOOLEAN NOT NULL DEFAULT TRUE,
+		ADD COLUMN IF NOT EXISTS validated BOOLEAN NOT NULL DEFAULT TRUE,
+		ADD COLUMN IF NOT EXISTS problems TEXT NOT NULL DEFAULT '';`, SchemaName, VersionTableName),
+	postgresVersionInsert: fmt.Sprintf(`INSERT INTO %s.%s (script_id, version, script, hash, author, valid, validated, problems, create_time)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, $7, current_timestamp FROM %s.%s WHERE script_id = $1
+		RETURNING version`, SchemaName, VersionTableName, SchemaName, VersionTableName),
+	postgresVersionSelectAll: fmt.Sprintf(`SELECT script_id, version, hash, author, valid, validated, problems, create_time FROM %s.%s WHERE script_id = $1 ORDER BY version DESC`, SchemaName, VersionTableName),
+	postgresVersionSelect:    fmt.Sprintf(`SELECT script_id, version, script, hash, author, valid, validated, problems, create_time FROM %s.%s WHERE script_id = $1 AND version = $2`, SchemaName, VersionTableName),
+}
+
+func CreateVersionTable(db *sql.DB) error {
+	_, err := db.Exec(versionSQLString[postgresVersionCreateTable])
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(versionSQLString[postgresVersionAlterTable])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func Hash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+func insertVersion(tx *sql.Tx, scriptID uint32, script string, author string, valid bool, validated bool, problems json.RawMessage) (int, error) {
+	var version int
+	row := tx.QueryRow(versionSQLString[postgresVersionInsert], scriptID, script, Hash(script), author, valid, validated, string(problems))
+	if err := row.Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func SelectVersions(db *sql.DB, scriptID uint32) ([]*Version, error) {
+	rows, err := db.Query(versionSQLString[postgresVersionSelectAll], scriptID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := []*Version{}
+	for rows.Next() {
+		var problems string
+		v := &Version{}
+		if err := rows.Scan(&v.ScriptID, &v.Version, &v.Hash, &v.Author, &v.Valid, &v.Validated, &problems, &v.CreateTime); err != nil {
+			return nil, err
+		}
+		if problems != "" {
+			v.Problems = json.RawMessage(problems)
+		}
+
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func SelectVersion(db *sql.DB, scriptID uint32, version int) (*Version, error) {
+	row := db.QueryRow(versionSQLString[postgresVersionSelect], scriptID, version)
+	var problems string
+	v := &Version{}
+	if err := row.Scan(&v.ScriptID, &v.Version, &v.Script, &v.Hash, &v.Author, &v.Valid, &v.Validated, &problems, &v.CreateTime); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d of script %d", ErrVersionNotFound, version, scriptID)
+		}
+		return nil, err
+	}
+	if problems != "" {
+		v.Problems = json.RawMessage(problems)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/silverswords/cerebus/pkg/scheduler"
+)
+
+// embedded is the runner of the embedded runtime
+type embedded struct{}
+
+// Run runs job with runEmbedded
+func (embedded) Run(ctx context.Context, job Job) error {
+	return runEmbedded(ctx, job)
+}
+
+// runEmbedded runs the source of job in the embedded runtime with its host API. The params
+// are globals of their JSON types, console.log writes to the stdout and console.error to the
+// stderr, and the value of the last statement is the result of the task. A thrown error is
+// returned as an ExitError with the code 1.
+func runEmbedded(ctx context.Context, job Job) error {
+	t := scheduler.NewJsTask(job.Source)
+	t.SetHostAPI(job.Host)
+
+	for key, value := range job.Params {
+		if err := t.SetParam(key, value); err != nil {
+			return err
+		}
+	}
+	if err := t.SetParam("CEREBUS_TASK_ID", fmt.Sprint(job.TaskID)); err != nil {
+		return err
+	}
+	if job.Checkpoint != nil {
+		if err := t.SetParam("CEREBUS_CHECKPOINT", string(job.Checkpoint)); err != nil {
+			return err
+		}
+	}
+
+	var errTail tail
+	stdout := job.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	t.SetOutput(stdout)
+	t.SetErrorOutput(stderr(job, &errTail))
+
+	err := t.Do(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return &ExitError{
+			Code:   1,
+			Stderr: strings.TrimSpace(errTail.String()),
+			Err:    err,
+		}
+	}
+
+	return nil
+}
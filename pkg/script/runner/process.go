@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Process runs the scripts in a subprocess, as Path Args... <source> [Argv0] key=value...
+type Process struct {
+	Path string
+	Args []string
+	// Argv0 is passed before the params to the shells, which take the first argument after
+	// the source as $0
+	Argv0 string
+
+	// Check are the arguments of Path checks the syntax of the source from the stdin without
+	// running it, such as sh -n
+	Check []string
+	// CheckError parses the stderr of a failed Check, the whole stderr is the message of the
+	// problem by default
+	CheckError func(stderr string) Problem
+}
+
+// Run runs the source of job in a subprocess, which is killed with its children when ctx is
+// done
+func (p *Process) Run(ctx context.Context, job Job) error {
+	params, err := args(job.Params)
+	if err != nil {
+		return err
+	}
+
+	argv := append(append([]string{}, p.Args...), job.Source)
+	if p.Argv0 != "" {
+		argv = append(argv, p.Argv0)
+	}
+	argv = append(argv, params...)
+
+	env, err := environ(job)
+	if err != nil {
+		return err
+	}
+
+	var errTail tail
+	cmd := exec.Command(p.Path, argv...)
+	cmd.Env = env
+	cmd.Stdout = job.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = io.Discard
+	}
+	cmd.Stderr = stderr(job, &errTail)
+	// the children of the script are killed with it, or they would keep the output open
+	setpgid(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			kill(cmd)
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{
+			Code:   exitErr.ExitCode(),
+			Stderr: strings.TrimSpace(errTail.String()),
+			Err:    err,
+		}
+	}
+
+	return err
+}
+
+// environ returns the environment of the subprocess of job
+func environ(job Job) ([]string, error) {
+	params := job.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// the script spawns children by running tasks with its id as the parent_id
+	env := append(os.Environ(),
+		fmt.Sprintf("CEREBUS_TASK_ID=%d", job.TaskID),
+		"CEREBUS_PARAMS="+string(data),
+	)
+	if job.Checkpoint != nil {
+		env = append(env, "CEREBUS_CHECKPOINT="+string(job.Checkpoint))
+	}
+
+	return env, nil
+}
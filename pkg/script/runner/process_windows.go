@@ -0,0 +1,13 @@
+package runner
+
+import (
+	"os/exec"
+)
+
+// setpgid does nothing, the process groups are POSIX
+func setpgid(cmd *exec.Cmd) {}
+
+// kill kills the process of cmd
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,227 @@
+// Package runner runs the source of the scripts by their Type. The runners share the
+// conventions of the scripts:
+//
+//   - the params are key=value arguments sorted by key, the strings as they are and the
+//     other values as JSON, and CEREBUS_PARAMS is the JSON of them all. The embedded
+//     runtime sets them as globals instead.
+//   - CEREBUS_TASK_ID is the id of the task and CEREBUS_CHECKPOINT the last checkpoint
+//     saved, if there is one.
+//   - the stdout is the output of the task and may have protocol lines, the stderr is
+//     for the diagnostics.
+//   - a script exits with 0 on success, otherwise an ExitError with the exit code and the
+//     tail of the stderr is returned.
+//   - the error of the context is returned when the script is cancelled.
+//
+// The runners implement Validator to check the syntax of the scripts before they are run.
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/silverswords/cerebus/pkg/scheduler"
+)
+
+// the types of the built-in runners
+const (
+	Node     = "node"
+	Embedded = "embedded"
+	Shell    = "sh"
+	Python   = "python3"
+)
+
+// LegacyTypes maps the types the scripts were created with before the runners were chosen by
+// type to the runners ran them then. They're migrated once by -migrate-script-types, the
+// scripts of the other unknown types can't run until they are given a known type.
+var LegacyTypes = map[string]string{
+	"":           Node,
+	"js":         Node,
+	"javascript": Node,
+	"nodejs":     Node,
+}
+
+var (
+	// ErrUnknownType is returned when there isn't a runner for the type of a script
+	ErrUnknownType = errors.New("unknown script type")
+	// ErrDuplicateType is returned when a type is registered twice
+	ErrDuplicateType = errors.New("script type already registered")
+	// ErrNoValidator is returned when the program checks the scripts can't be found
+	ErrNoValidator = errors.New("script validator unavailable")
+)
+
+// Job is a run of a script
+type Job struct {
+	TaskID     uint32
+	Source     string
+	Params     map[string]interface{}
+	Checkpoint []byte
+	// Host is the host API of the embedded scripts
+	Host scheduler.HostAPI
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs the source of the scripts of a type
+type Runner interface {
+	Run(ctx context.Context, job Job) error
+}
+
+// RunnerFunc is a function as a Runner
+type RunnerFunc func(ctx context.Context, job Job) error
+
+// Run calls f
+func (f RunnerFunc) Run(ctx context.Context, job Job) error {
+	return f(ctx, job)
+}
+
+// ExitError is returned when a script fails
+type ExitError struct {
+	Code int
+	// Stderr is the tail of the stderr of the script
+	Stderr string
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%v: %s", e.Err, e.Stderr)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Registry maps the types of the scripts to their runners
+type Registry struct {
+	mu      sync.RWMutex
+	runners map[string]Runner
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		runners: map[string]Runner{},
+	}
+}
+
+// Default returns a Registry of the built-in runners
+func Default() *Registry {
+	r := NewRegistry()
+	r.Register(Node, &Process{Path: "node", Args: []string{"-e"}, Check: []string{"-e", nodeCheck}, CheckError: nodeProblem})
+	r.Register(Embedded, embedded{})
+	r.Register(Shell, &Process{Path: "sh", Args: []string{"-c"}, Argv0: "cerebus", Check: []string{"-n"}, CheckError: shellProblem})
+	r.Register(Python, &Process{Path: "python3", Args: []string{"-c"}, Check: []string{"-c", pythonCheck}, CheckError: pythonProblem})
+
+	return r
+}
+
+// Register adds runner for the scripts of typ
+func (r *Registry) Register(typ string, runner Runner) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.runners[typ]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateType, typ)
+	}
+
+	r.runners[typ] = runner
+	return nil
+}
+
+// Runner returns the runner of typ, ErrUnknownType is returned if there isn't one
+func (r *Registry) Runner(typ string) (Runner, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	runner, ok := r.runners[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, typ)
+	}
+
+	return runner, nil
+}
+
+// Types returns the sorted types of the runners
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.runners))
+	for typ := range r.runners {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// args returns the params as key=value arguments sorted by key
+func args(params map[string]interface{}) ([]string, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, ok := params[key].(string)
+		if !ok {
+			data, err := json.Marshal(params[key])
+			if err != nil {
+				return nil, fmt.Errorf("param %s: %w", key, err)
+			}
+			value = string(data)
+		}
+
+		args = append(args, key+"="+value)
+	}
+
+	return args, nil
+}
+
+// maxTail is how much of the stderr is kept for the ExitError
+const maxTail = 4 << 10
+
+// tail keeps the last maxTail bytes written
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > maxTail {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-maxTail:]...)
+	}
+
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return string(t.buf)
+}
+
+// stderr returns the writer of the stderr of job, which is also kept in t
+func stderr(job Job, t *tail) io.Writer {
+	if job.Stderr == nil {
+		return t
+	}
+
+	return io.MultiWriter(job.Stderr, t)
+}
@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestShell(t *testing.T) {
+	r, err := Default().Runner(Shell)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = r.Run(context.Background(), Job{
+		TaskID: 7,
+		Source: `echo "$0 $# $1 $2 $CEREBUS_TASK_ID $CEREBUS_PARAMS"; echo oops >&2`,
+		Params: map[string]interface{}{"b": 2, "a": "x y"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "cerebus 2 a=x y b=2 7 {\"a\":\"x y\",\"b\":2}\n"; stdout.String() != expected {
+		t.Errorf("stdout is expected as %q, actually %q", expected, stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("stderr is expected as %q, actually %q", "oops\n", stderr.String())
+	}
+
+	err = r.Run(context.Background(), Job{Source: `echo failed >&2; exit 3`})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 || exitErr.Stderr != "failed" {
+		t.Errorf("exit error is expected with 3 and the stderr, actually %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.Run(ctx, Job{Source: `sleep 5`}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error is expected as %v, actually %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	r, err := Default().Runner(Embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = r.Run(context.Background(), Job{
+		TaskID: 7,
+		Source: `console.log(CEREBUS_TASK_ID, count + 1); console.error("oops")`,
+		Params: map[string]interface{}{"count": 1},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "7 2\n" || stderr.String() != "oops\n" {
+		t.Errorf("output is unexpected: %q %q", stdout.String(), stderr.String())
+	}
+
+	err = r.Run(context.Background(), Job{Source: `console.error("failed"); throw new Error("boom")`})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 || exitErr.Stderr != "failed" {
+		t.Errorf("exit error is expected with 1 and the stderr, actually %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.Run(ctx, Job{Source: `while (true) {}`}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error is expected as %v, actually %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := Default()
+	if _, err := r.Runner("ruby"); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnknownType, err)
+	}
+	if err := r.Register(Node, &Process{Path: "node"}); !errors.Is(err, ErrDuplicateType) {
+		t.Errorf("error is expected as %v, actually %v", ErrDuplicateType, err)
+	}
+
+	types := r.Types()
+	if len(types) != 4 || types[0] != Embedded || types[3] != Shell {
+		t.Errorf("types are unexpected: %v", types)
+	}
+
+	// the legacy types are migrated to runners, they aren't types of their own
+	for old, typ := range LegacyTypes {
+		if _, err := r.Runner(old); !errors.Is(err, ErrUnknownType) {
+			t.Errorf("legacy type %q is expected to be unknown, actually %v", old, err)
+		}
+		if _, err := r.Runner(typ); err != nil {
+			t.Errorf("legacy type %q is expected to be migrated to a runner, actually %v", old, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := Default()
+	ctx := context.Background()
+
+	problems, err := r.Validate(ctx, Embedded, "var a = 1;\nvar b = );\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) == 0 || problems[0].Line != 2 || problems[0].Column != 9 {
+		t.Errorf("problem is expected at 2:9, actually %v", problems)
+	}
+
+	problems, err = r.Validate(ctx, Shell, "echo hi\nif then\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line != 2 {
+		t.Errorf("problem is expected at line 2, actually %v", problems)
+	}
+
+	for _, typ := range []string{Embedded, Shell} {
+		if problems, err := r.Validate(ctx, typ, "a = 1\n"); err != nil || len(problems) != 0 {
+			t.Errorf("%s script is expected to be valid, actually %v %v", typ, problems, err)
+		}
+	}
+
+	// node -e runs the source as a script, where a top-level return is illegal
+	if _, err := exec.LookPath("node"); err == nil {
+		problems, err = r.Validate(ctx, Node, "var a = 1\nreturn a\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) != 1 || problems[0].Line != 2 {
+			t.Errorf("problem is expected at line 2, actually %v", problems)
+		}
+	}
+
+	missing := &Process{Path: "cerebus-missing-validator", Check: []string{"-n"}}
+	if _, err := missing.Validate(ctx, "a = 1\n"); !errors.Is(err, ErrNoValidator) {
+		t.Errorf("error is expected as %v, actually %v", ErrNoValidator, err)
+	}
+
+	if _, err := r.Validate(ctx, "ruby", ""); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("error is expected as %v, actually %v", ErrUnknownType, err)
+	}
+}
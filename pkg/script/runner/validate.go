@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/robertkrimen/otto/parser"
+)
+
+// Problem is an error found in the source of a script, Line and Column are from 1 and 0 when
+// they aren't known
+type Problem struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// Validator is implemented by the runners can check the source of a script without running
+// it, the problems found are returned, and the error is for the failures of the check itself
+type Validator interface {
+	Validate(ctx context.Context, source string) ([]Problem, error)
+}
+
+// Validate checks source with the runner of typ, the source of the runners aren't Validator
+// is accepted as it is
+func (r *Registry) Validate(ctx context.Context, typ string, source string) ([]Problem, error) {
+	runner, err := r.Runner(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := runner.(Validator)
+	if !ok {
+		return nil, nil
+	}
+
+	return v.Validate(ctx, source)
+}
+
+// Validate parses source as the embedded runtime does
+func (embedded) Validate(ctx context.Context, source string) ([]Problem, error) {
+	_, err := parser.ParseFile(nil, "", source, 0)
+	if err == nil {
+		return nil, nil
+	}
+
+	var list parser.ErrorList
+	if !errors.As(err, &list) {
+		return []Problem{{Message: err.Error()}}, nil
+	}
+
+	// the parser may report an error again while it recovers
+	problems := make([]Problem, 0, len(list))
+	seen := map[Problem]bool{}
+	for _, e := range list {
+		p := Problem{
+			Line:    e.Position.Line,
+			Column:  e.Position.Column,
+			Message: e.Message,
+		}
+		if !seen[p] {
+			seen[p] = true
+			problems = append(problems, p)
+		}
+	}
+
+	return problems, nil
+}
+
+// Validate runs the Check of p with source as the stdin, the source is accepted if p has no
+// Check
+func (p *Process) Validate(ctx context.Context, source string) ([]Problem, error) {
+	if len(p.Check) == 0 {
+		return nil, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path, p.Check...)
+	cmd.Stdin = strings.NewReader(source)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrNoValidator, err)
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, err
+	}
+
+	parse := p.CheckError
+	if parse == nil {
+		parse = func(stderr string) Problem {
+			return Problem{Message: strings.TrimSpace(stderr)}
+		}
+	}
+
+	return []Problem{parse(stderr.String())}, nil
+}
+
+var (
+	nodeCheckLine  = regexp.MustCompile(`^\[stdin\]:(\d+)`)
+	nodeCheckError = regexp.MustCompile(`(?m)^\w*Error: .*$`)
+	shellCheckLine = regexp.MustCompile(`^[^:]*: (?:line )?(\d+): (.*)`)
+)
+
+// nodeCheck compiles the stdin as node -e runs it, as a script rather than a module, so that
+// such as a top-level return is a problem too, and prints the stack of a SyntaxError
+const nodeCheck = `const source = require("fs").readFileSync(0, "utf8")
+try {
+  new (require("vm").Script)(source, { filename: "[stdin]" })
+} catch (e) {
+  process.stderr.write(String(e.stack))
+  process.exit(1)
+}`
+
+// nodeProblem parses the stderr of nodeCheck
+func nodeProblem(stderr string) Problem {
+	p := Problem{Message: strings.TrimSpace(stderr)}
+	if m := nodeCheckLine.FindStringSubmatch(stderr); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+	}
+	if m := nodeCheckError.FindString(stderr); m != "" {
+		p.Message = m
+	}
+
+	return p
+}
+
+// shellProblem parses the stderr of sh -n, such as "sh: 2: Syntax error: ..."
+func shellProblem(stderr string) Problem {
+	line := strings.TrimSpace(strings.SplitN(stderr, "\n", 2)[0])
+	p := Problem{Message: line}
+	if m := shellCheckLine.FindStringSubmatch(line); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+		p.Message = m[2]
+	}
+
+	return p
+}
+
+// pythonCheck compiles the stdin and prints line:column:message of a SyntaxError
+const pythonCheck = `import sys
+try:
+    compile(sys.stdin.read(), "<script>", "exec")
+except SyntaxError as e:
+    sys.stderr.write("%d:%d:%s" % (e.lineno or 0, e.offset or 0, e.msg))
+    sys.exit(1)`
+
+// pythonProblem parses the stderr of pythonCheck
+func pythonProblem(stderr string) Problem {
+	parts := strings.SplitN(strings.TrimSpace(stderr), ":", 3)
+	if len(parts) != 3 {
+		return Problem{Message: strings.TrimSpace(stderr)}
+	}
+
+	line, _ := strconv.Atoi(parts[0])
+	column, _ := strconv.Atoi(parts[1])
+	return Problem{Line: line, Column: column, Message: parts[2]}
+}
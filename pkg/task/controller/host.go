@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/silverswords/cerebus/pkg/scheduler"
+	scriptmodel "github.com/silverswords/cerebus/pkg/script/model"
+)
+
+// maxObjectSize is the largest object a script can read
+const maxObjectSize = 10 << 20
+
+// AllowHosts sets the hosts the embedded scripts can fetch, "*.example.com" allows the
+// subdomains of example.com
+func (tc *TaskController) AllowHosts(hosts ...string) {
+	tc.fetchHosts = tc.fetchHosts[:0]
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host != "" {
+			tc.fetchHosts = append(tc.fetchHosts, host)
+		}
+	}
+}
+
+// hostAPI returns the host API of an embedded script, with the capabilities granted to it
+func (tc *TaskController) hostAPI(script *scriptmodel.Script, taskID uint32) scheduler.HostAPI {
+	return scheduler.HostAPI{
+		Capabilities: []scheduler.Capability{
+			scheduler.FetchCapability(nil, tc.fetchHosts),
+			tc.kvCapability(script.ID),
+			tc.objectsCapability(taskID),
+			scheduler.LogCapability(),
+		},
+		Granted: script.Capabilities,
+	}
+}
+
+// kvCapability is the "kv" capability, kv.get(key), kv.set(key, value), kv.delete(key) and
+// kv.keys() on the values of the script, which are kept as JSON
+func (tc *TaskController) kvCapability(scriptID uint32) scheduler.Capability {
+	return scheduler.Capability{
+		Name: scriptmodel.CapabilityKV,
+		Funcs: map[string]scheduler.HostFunc{
+			"get": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				key, err := stringArg(args, 0, "key")
+				if err != nil {
+					return nil, err
+				}
+
+				data, ok, err := scriptmodel.GetValue(ctx, tc.db, scriptID, key)
+				if err != nil || !ok {
+					return nil, err
+				}
+
+				var value interface{}
+				if err := json.Unmarshal([]byte(data), &value); err != nil {
+					return nil, err
+				}
+				return value, nil
+			},
+			"set": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				key, err := stringArg(args, 0, "key")
+				if err != nil {
+					return nil, err
+				}
+				if len(args) < 2 {
+					return nil, errors.New("no value")
+				}
+
+				data, err := json.Marshal(args[1])
+				if err != nil {
+					return nil, err
+				}
+				return nil, scriptmodel.SetValue(ctx, tc.db, scriptID, key, string(data))
+			},
+			"delete": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				key, err := stringArg(args, 0, "key")
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, scriptmodel.DeleteValue(ctx, tc.db, scriptID, key)
+			},
+			"keys": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				return scriptmodel.SelectKeys(ctx, tc.db, scriptID)
+			},
+		},
+	}
+}
+
+// objectsCapability is the "objects" capability, objects.get(name), objects.put(name, data)
+// and objects.list() on the objects under the prefix of the task, <id>/
+func (tc *TaskController) objectsCapability(taskID uint32) scheduler.Capability {
+	prefix := fmt.Sprintf("%d/", taskID)
+	objectName := func(args []interface{}) (string, error) {
+		name, err := stringArg(args, 0, "name")
+		if err != nil {
+			return "", err
+		}
+		if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "..") {
+			return "", fmt.Errorf("invalid object name %q", name)
+		}
+
+		return prefix + name, nil
+	}
+
+	return scheduler.Capability{
+		Name: scriptmodel.CapabilityObjects,
+		Funcs: map[string]scheduler.HostFunc{
+			"get": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				name, err := objectName(args)
+				if err != nil {
+					return nil, err
+				}
+
+				object, err := tc.minioClient.GetObject(ctx, bucketName, name, minio.GetObjectOptions{})
+				if err != nil {
+					return nil, err
+				}
+				defer object.Close()
+
+				data, err := io.ReadAll(io.LimitReader(object, maxObjectSize+1))
+				if err != nil {
+					return nil, err
+				}
+				if len(data) > maxObjectSize {
+					return nil, fmt.Errorf("object is larger than %d bytes", maxObjectSize)
+				}
+				return string(data), nil
+			},
+			"put": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				name, err := objectName(args)
+				if err != nil {
+					return nil, err
+				}
+				data, err := stringArg(args, 1, "data")
+				if err != nil {
+					return nil, err
+				}
+
+				_, err = tc.minioClient.PutObject(ctx, bucketName, name, bytes.NewReader([]byte(data)), int64(len(data)), minio.PutObjectOptions{})
+				return nil, err
+			},
+			"list": func(ctx context.Context, args []interface{}) (interface{}, error) {
+				names := []string{}
+				for object := range tc.minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+					if object.Err != nil {
+						return nil, object.Err
+					}
+					names = append(names, strings.TrimPrefix(object.Key, prefix))
+				}
+				return names, nil
+			},
+		},
+	}
+}
+
+// stringArg returns the i-th argument of a host function, which must be a string
+func stringArg(args []interface{}, i int, name string) (string, error) {
+	if len(args) <= i {
+		return "", fmt.Errorf("no %s", name)
+	}
+
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s isn't a string", name)
+	}
+
+	return s, nil
+}
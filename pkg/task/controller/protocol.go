@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/silverswords/cerebus/pkg/scheduler"
+)
+
+// protocolPrefix starts the lines a script prints to stdout to talk to the scheduler,
+// the other lines are the output of the task:
+//
+//	::progress <percentage> <message>
+//	::heartbeat
+//	::checkpoint <data>
+//
+// The last checkpoint saved is passed back in the CEREBUS_CHECKPOINT environment variable
+// when the task is retried or run again.
+const protocolPrefix = "::"
+
+// scanOutput copies the output of a script to w line by line, the protocol lines are passed
+// to handle instead. r is drained on error so the script won't block on writing.
+func scanOutput(r io.Reader, w io.Writer, handle func(command, args string)) error {
+	if err := scanLines(r, w, handle); err != nil {
+		io.Copy(io.Discard, r)
+		return err
+	}
+
+	return nil
+}
+
+// scanLines reads r line by line, a long output line is copied in pieces so that there is no
+// limit on the length of the lines
+func scanLines(r io.Reader, w io.Writer, handle func(command, args string)) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, more, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !bytes.HasPrefix(line, []byte(protocolPrefix)) {
+			for {
+				if _, err := w.Write(line); err != nil {
+					return err
+				}
+				if !more {
+					break
+				}
+				if line, more, err = reader.ReadLine(); err != nil {
+					return err
+				}
+			}
+
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		command := string(line[len(protocolPrefix):])
+		for more {
+			if line, more, err = reader.ReadLine(); err != nil {
+				return err
+			}
+			command += string(line)
+		}
+
+		args := ""
+		if i := strings.IndexByte(command, ' '); i >= 0 {
+			command, args = command[:i], strings.TrimSpace(command[i+1:])
+		}
+
+		handle(command, args)
+	}
+}
+
+// parseProgress parses the arguments of a progress line
+func parseProgress(args string) (float64, string, error) {
+	pct, message := args, ""
+	if i := strings.IndexByte(args, ' '); i >= 0 {
+		pct, message = args[:i], strings.TrimSpace(args[i+1:])
+	}
+
+	progress, err := strconv.ParseFloat(pct, 64)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return progress, message, nil
+}
+
+// reportTo returns a handler of protocol lines reports to the task running with ctx,
+// progress is also passed to onProgress
+func reportTo(ctx context.Context, onProgress func(pct float64, message string)) func(command, args string) {
+	r := scheduler.ReporterFromContext(ctx)
+	return func(command, args string) {
+		switch command {
+		case "progress":
+			pct, message, err := parseProgress(args)
+			if err != nil {
+				r.Heartbeat()
+				return
+			}
+
+			r.Progress(pct, message)
+			onProgress(pct, message)
+		case "heartbeat":
+			r.Heartbeat()
+		case "checkpoint":
+			if err := scheduler.SaveCheckpoint(ctx, []byte(args)); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestScanOutput(t *testing.T) {
+	long := strings.Repeat("x", 2*1024*1024)
+	checkpoint := strings.Repeat("c", 8*1024)
+
+	input := "hello\n::progress 50 half way\n" + long + "\n::checkpoint " + checkpoint + "\nbye"
+	var out bytes.Buffer
+	var commands []string
+	err := scanOutput(strings.NewReader(input), &out, func(command, args string) {
+		commands = append(commands, command+" "+args)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "hello\n" + long + "\nbye\n"; out.String() != expected {
+		t.Errorf("output is expected as %d bytes, actually %d", len(expected), out.Len())
+	}
+	if len(commands) != 2 || commands[0] != "progress 50 half way" || commands[1] != "checkpoint "+checkpoint {
+		t.Errorf("commands are unexpected: %d %.40q", len(commands), commands)
+	}
+}
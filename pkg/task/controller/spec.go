@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/silverswords/cerebus/pkg/scheduler"
+	scriptmodel "github.com/silverswords/cerebus/pkg/script/model"
+	"github.com/silverswords/cerebus/pkg/task/model"
+)
+
+// ScriptHandler is the name of the handler runs the scripts submitted as task specs
+const ScriptHandler = "script"
+
+// scriptPayload is the payload of the task specs of ScriptHandler, as the body of /task/run
+type scriptPayload struct {
+	ID     uint32                 `json:"id"`
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	// Version pins the version of the script, the current one is run by default
+	Version int `json:"version,omitempty"`
+}
+
+// RegisterHandlers registers the handlers of the task specs to r
+func (tc *TaskController) RegisterHandlers(r *scheduler.Registry) error {
+	if err := r.Register(ScriptHandler, tc.runSpec); err != nil {
+		return err
+	}
+
+	return r.Prepare(ScriptHandler, tc.prepareSpec)
+}
+
+// prepareSpec records a task spec of ScriptHandler as a task row and gives the spec the id of
+// the row, so that the task is cancelled and looked up by the same id as the ones of /run.
+// The version of the script is pinned in the payload, a spec with an id is submitted again
+// and has its row already.
+func (tc *TaskController) prepareSpec(spec *scheduler.TaskSpec) error {
+	var p scriptPayload
+	if err := json.Unmarshal(spec.Payload, &p); err != nil {
+		return fmt.Errorf("%w: %v", scheduler.ErrInvalidSpec, err)
+	}
+	if p.ID == 0 || p.Name == "" {
+		return fmt.Errorf("%w: script payload needs an id and a name", scheduler.ErrInvalidSpec)
+	}
+
+	if spec.ID != "" {
+		if _, err := strconv.ParseUint(spec.ID, 10, 32); err != nil {
+			return fmt.Errorf("%w: script task id %q isn't the id of a task", scheduler.ErrInvalidSpec, spec.ID)
+		}
+		return nil
+	}
+
+	var parentID uint64
+	if spec.ParentID != "" {
+		id, err := strconv.ParseUint(spec.ParentID, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%w: parent id %q isn't the id of a task", scheduler.ErrInvalidSpec, spec.ParentID)
+		}
+		parentID = id
+	}
+
+	script, err := scriptmodel.SelectScriptByID(tc.db, p.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tc.runners.Runner(script.Type); err != nil {
+		return fmt.Errorf("%w: %v", scheduler.ErrInvalidSpec, err)
+	}
+
+	_, version, err := tc.source(script, p.Version)
+	if err != nil {
+		return err
+	}
+
+	p.Version = version
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	spec.Payload = payload
+
+	// the spec is kept with the row, so that the task can be recovered after a restart
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := model.InsertTask(tc.db, p.Name, p.ID, version, uint32(parentID), string(data)); err != nil {
+		return err
+	}
+
+	taskID, err := model.SelectIDByName(tc.db, p.Name)
+	if err != nil {
+		return err
+	}
+
+	spec.ID = strconv.Itoa(int(taskID))
+	return nil
+}
+
+// runSpec runs the script described by the payload of a task spec on the row of the task
+// given by prepareSpec. A spec has no outcome callback, so the task is recorded when it
+// starts and finished by the handler, the rows of the ones cancelled or shed before they
+// start are left pending.
+func (tc *TaskController) runSpec(ctx context.Context, payload json.RawMessage) error {
+	var p scriptPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("%w: %v", scheduler.ErrInvalidSpec, err)
+	}
+
+	id, _ := scheduler.TaskIDFromContext(ctx)
+	rowID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: script task id %q isn't the id of a task", scheduler.ErrInvalidSpec, id)
+	}
+	taskID := uint32(rowID)
+
+	script, err := scriptmodel.SelectScriptByID(tc.db, p.ID)
+	if err != nil {
+		return err
+	}
+
+	run, err := tc.runners.Runner(script.Type)
+	if err != nil {
+		return err
+	}
+
+	source, _, err := tc.source(script, p.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := model.TaskRun(tc.db, taskID); err != nil {
+		return err
+	}
+	defer os.Remove(resultPath(taskID))
+
+	err = tc.execute(ctx, run, script, taskID, source, p.Params)
+	if err == nil {
+		err = tc.store(taskID, nil)
+	}
+	if err != nil {
+		if err := model.TaskError(tc.db, taskID, err); err != nil {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return model.TaskFinish(tc.db, taskID)
+}
+
+// Recover schedules the tasks were running when the server stopped again by the specs kept
+// with their rows, they resume from their checkpoints. The parents may not be running any
+// more, so the children are recovered on their own. The other checkpoints are deleted first,
+// they'd never be resumed.
+func (tc *TaskController) Recover() error {
+	if err := model.PurgeCheckpoints(tc.db); err != nil {
+		return err
+	}
+
+	tasks, err := model.SelectRunning(tc.db)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		if err := tc.recover(t); err != nil {
+			log.Println(err)
+			if err := model.TaskError(tc.db, t.ID, fmt.Errorf("recover task: %w", err)); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// recover schedules the task of row again by its spec
+func (tc *TaskController) recover(row *model.Task) error {
+	// the tasks run before the specs were kept have none
+	if row.Spec == "" {
+		return fmt.Errorf("%w: task %d has no spec", scheduler.ErrInvalidSpec, row.ID)
+	}
+
+	var spec scheduler.TaskSpec
+	if err := json.Unmarshal([]byte(row.Spec), &spec); err != nil {
+		return fmt.Errorf("%w: %v", scheduler.ErrInvalidSpec, err)
+	}
+
+	var p scriptPayload
+	if err := json.Unmarshal(spec.Payload, &p); err != nil {
+		return fmt.Errorf("%w: %v", scheduler.ErrInvalidSpec, err)
+	}
+
+	script, err := scriptmodel.SelectScriptByID(tc.db, p.ID)
+	if err != nil {
+		return err
+	}
+
+	run, err := tc.runners.Runner(script.Type)
+	if err != nil {
+		return err
+	}
+
+	source, _, err := tc.source(script, p.Version)
+	if err != nil {
+		return err
+	}
+
+	return tc.sche.Recover(tc.task(row.ID, spec, script, run, source, p.Params))
+}
@@ -1,34 +1,46 @@
 package controller
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/minio/minio-go/v7"
 	"github.com/silverswords/cerebus/pkg/scheduler"
-	script "github.com/silverswords/cerebus/pkg/script/model"
+	scriptmodel "github.com/silverswords/cerebus/pkg/script/model"
+	"github.com/silverswords/cerebus/pkg/script/runner"
 	"github.com/silverswords/cerebus/pkg/task/model"
 )
 
 var (
 	bucketName = "task"
 	location   = "us-east-1"
+
+	// retryAfter is the delay suggested to clients when the scheduler is saturated
+	retryAfter = 5 * time.Second
 )
 
 type TaskController struct {
 	db          *sql.DB
 	sche        *scheduler.Scheduler
 	minioClient *minio.Client
+	runners     *runner.Registry
+	// fetchHosts are the hosts the embedded scripts can fetch
+	fetchHosts []string
 }
 
-func New(db *sql.DB, sche *scheduler.Scheduler, minioClient *minio.Client) *TaskController {
+func New(db *sql.DB, sche *scheduler.Scheduler, minioClient *minio.Client, runners *runner.Registry) *TaskController {
 	ctx := context.Background()
 	err := minioClient.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: location})
 	if err != nil {
@@ -46,6 +58,7 @@ func New(db *sql.DB, sche *scheduler.Scheduler, minioClient *minio.Client) *Task
 		db:          db,
 		sche:        sche,
 		minioClient: minioClient,
+		runners:     runners,
 	}
 }
 
@@ -60,8 +73,15 @@ func (tc *TaskController) RegisterRouter(r gin.IRouter) {
 		return
 	}
 
+	if err := model.CreateCheckpointTable(tc.db); err != nil {
+		log.Fatal(err)
+		return
+	}
+
 	r.GET("/tasks", tc.getTasks)
 	r.POST("/run", tc.run)
+	r.POST("/cancel", tc.cancel)
+	r.POST("/simulate", tc.simulate)
 }
 
 func (tc *TaskController) getTasks(c *gin.Context) {
@@ -78,9 +98,19 @@ func (tc *TaskController) getTasks(c *gin.Context) {
 
 func (tc *TaskController) run(c *gin.Context) {
 	var req struct {
-		ID     uint32                 `json:"id,omitempty" binding:"required"`
-		Name   string                 `json:"name,omitempty" binding:"required"`
-		Params map[string]interface{} `json:"params,omitempty"`
+		ID       uint32                 `json:"id,omitempty" binding:"required"`
+		Name     string                 `json:"name,omitempty" binding:"required"`
+		Params   map[string]interface{} `json:"params,omitempty"`
+		ParentID uint32                 `json:"parent_id,omitempty"`
+		// Version pins the version of the script, the current one is run by default
+		Version   int                 `json:"version,omitempty"`
+		Resources scheduler.Resources `json:"resources,omitempty"`
+		Selector  scheduler.Selector  `json:"selector,omitempty"`
+		Calendar  scheduler.Calendar  `json:"calendar,omitempty"`
+		Deadline  time.Time           `json:"deadline,omitempty"`
+		// TTL is how long the task may wait to start, such as "30m"
+		TTL   scheduler.Duration `json:"ttl,omitempty"`
+		Retry uint               `json:"retry,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -89,85 +119,420 @@ func (tc *TaskController) run(c *gin.Context) {
 		return
 	}
 
-	script, err := script.SelectScriptByID(tc.db, req.ID)
+	if req.TTL < 0 {
+		c.Error(fmt.Errorf("invalid ttl %v", time.Duration(req.TTL)))
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	script, err := scriptmodel.SelectScriptByID(tc.db, req.ID)
 	if err != nil {
 		c.Error(err)
 		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
 		return
 	}
 
-	if err := model.InsertTask(tc.db, req.Name, req.ID); err != nil {
+	run, err := tc.runners.Runner(script.Type)
+	if err != nil {
 		c.Error(err)
-		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
 		return
 	}
 
-	taskID, err := model.SelectIDByName(tc.db, req.Name)
+	source, version, err := tc.source(script, req.Version)
 	if err != nil {
 		c.Error(err)
+		if errors.Is(err, scriptmodel.ErrVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+			return
+		}
+
+		var invalid *invalidVersionError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"status": http.StatusUnprocessableEntity, "problems": invalid.version.Problems})
+			return
+		}
+
 		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
 		return
 	}
 
-	realScript, err := url.QueryUnescape(script.Script)
+	// the request is kept as a task spec, so that the task can be recovered after a restart
+	payload, err := json.Marshal(scriptPayload{ID: req.ID, Name: req.Name, Params: req.Params, Version: version})
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	spec := scheduler.TaskSpec{
+		Handler:   ScriptHandler,
+		Payload:   payload,
+		Retry:     req.Retry,
+		Deadline:  req.Deadline,
+		TTL:       req.TTL,
+		Resources: req.Resources,
+		Selector:  req.Selector,
+		Calendar:  req.Calendar,
+	}
+	if req.ParentID != 0 {
+		spec.ParentID = strconv.Itoa(int(req.ParentID))
+	}
+
+	data, err := json.Marshal(spec)
 	if err != nil {
 		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
 		return
 	}
 
-	resultPath := fmt.Sprintf("%d.txt", taskID)
-	if err := tc.sche.Schedule(scheduler.TaskFunc(func(context context.Context) error {
-		args := []string{"-e", realScript}
-		for key, value := range req.Params {
-			args = append(args, fmt.Sprintf("%s=%s", key, value))
+	if err := model.InsertTask(tc.db, req.Name, req.ID, version, req.ParentID, string(data)); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	taskID, err := model.SelectIDByName(tc.db, req.Name)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+		return
+	}
+
+	t := tc.task(taskID, spec, script, run, source, req.Params)
+
+	schedule := tc.sche.Schedule
+	if req.ParentID != 0 {
+		schedule = func(t scheduler.Task) error {
+			return tc.sche.ScheduleChild(strconv.Itoa(int(req.ParentID)), t)
+		}
+	}
+
+	if err := schedule(t); err != nil {
+		c.Error(err)
+		if errors.Is(err, scheduler.ErrTaskNotFound) {
+			if err := model.TaskReject(tc.db, taskID, fmt.Errorf("parent task %d: %w", req.ParentID, err)); err != nil {
+				c.Error(err)
+			}
+
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+			return
 		}
 
-		resultFile, err := os.Create(resultPath)
-		if err != nil {
-			return err
+		if errors.Is(err, scheduler.ErrCancelled) {
+			if err := model.TaskReject(tc.db, taskID, fmt.Errorf("parent task %d: %w", req.ParentID, err)); err != nil {
+				c.Error(err)
+			}
+
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+			return
 		}
-		defer resultFile.Close()
-		process := exec.Command("node", args...)
-		process.Stdout = resultFile
 
-		if err := process.Run(); err != nil {
-			return err
+		if errors.Is(err, scheduler.ErrDuplicateTask) {
+			if err := model.TaskReject(tc.db, taskID, err); err != nil {
+				c.Error(err)
+			}
+
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+			return
 		}
 
-		return nil
+		if errors.Is(err, scheduler.ErrExceedsCapacity) || errors.Is(err, scheduler.ErrUnschedulable) ||
+			errors.Is(err, scheduler.ErrInvalidCalendar) || errors.Is(err, scheduler.ErrDeadlineUnmeetable) {
+			if err := model.TaskReject(tc.db, taskID, err); err != nil {
+				c.Error(err)
+			}
+
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+			return
+		}
+
+		if errors.Is(err, scheduler.ErrQueueFull) {
+			if err := model.TaskReject(tc.db, taskID, err); err != nil {
+				c.Error(err)
+			}
+
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"status": http.StatusTooManyRequests})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	// the task may have started already
+	position, start, err := tc.sche.Estimate(strconv.Itoa(int(taskID)))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "id": taskID})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "id": taskID, "position": position, "estimated_start": start})
+}
+
+// task returns the task runs source of script on the task row with taskID, it's set up by
+// spec except the parent, and its states are recorded by its outcome
+func (tc *TaskController) task(taskID uint32, spec scheduler.TaskSpec, script *scriptmodel.Script, run runner.Runner, source string, params map[string]interface{}) scheduler.Task {
+	t := scheduler.TaskFunc(func(ctx context.Context) error {
+		return tc.execute(ctx, run, script, taskID, source, params)
 	}).AddStartCallback(func(context.Context) error {
 		err := model.TaskRun(tc.db, taskID)
 		if err != nil {
 			return err
 		}
 		return nil
-	}).(scheduler.CallbackTask).AddFinishedCallback(func(context.Context) error {
-		info, err := tc.minioClient.FPutObject(context.Background(), bucketName, resultPath, resultPath, minio.PutObjectOptions{})
+	}).(scheduler.OutcomeTask).OnOutcome(func(ctx context.Context, o scheduler.Outcome) {
+		defer os.Remove(resultPath(taskID))
 
-		if err != nil {
-			log.Fatalln(err)
+		if errors.Is(o.Reason, scheduler.ErrCancelled) {
+			if err := model.TaskCancel(tc.db, taskID); err != nil {
+				log.Println(err)
+			}
+			return
 		}
 
-		log.Print(info)
+		if errors.Is(o.Reason, scheduler.ErrExpired) {
+			if err := model.TaskExpire(tc.db, taskID, o.Err); err != nil {
+				log.Println(err)
+			}
+			return
+		}
 
-		if err := os.Remove(resultPath); err != nil {
-			return err
+		if errors.Is(o.Reason, scheduler.ErrShed) {
+			if err := model.TaskShed(tc.db, taskID, o.Err); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+
+		err := o.Err
+		if err == nil {
+			err = tc.store(taskID, o.Result)
+		}
+		if err != nil {
+			if err := model.TaskError(tc.db, taskID, err); err != nil {
+				log.Println(err)
+			}
+			return
 		}
 
 		if err := model.TaskFinish(tc.db, taskID); err != nil {
-			return err
+			log.Println(err)
 		}
+	}).(scheduler.ResourceTask).WithResources(spec.Resources).(scheduler.SelectorTask).WithSelector(spec.Selector).(scheduler.IdentifiedTask).WithID(strconv.Itoa(int(taskID))).(scheduler.CalendarTask).WithCalendar(spec.Calendar).(scheduler.TypedTask).WithType(script.Type).(scheduler.RetryTask).WithRetry(spec.Retry)
+	if spec.Priority != 0 {
+		t = t.(scheduler.PriorityTask).WithPriority(spec.Priority)
+	}
+	if spec.Breaker != "" {
+		t = t.(scheduler.BreakerTask).WithBreaker(spec.Breaker)
+	}
+	// a deadline replaces the timeout, as for the specs of the other handlers
+	if !spec.Deadline.IsZero() {
+		t = t.(scheduler.DeadlineTask).WithDeadline(spec.Deadline)
+	} else if spec.Timeout > 0 {
+		t = t.(scheduler.RetryTask).WithTimeout(time.Duration(spec.Timeout))
+	}
+	if spec.TTL > 0 {
+		t = t.(scheduler.TTLTask).WithTTL(time.Duration(spec.TTL))
+	}
 
-		return nil
-	}).(scheduler.RetryTask).WithCatch(func(err error) {
-		model.TaskError(tc.db, taskID, err)
-	})); err != nil {
-		log.Fatal(4)
+	return t
+}
+
+func (tc *TaskController) cancel(c *gin.Context) {
+	var req struct {
+		ID uint32 `json:"id,omitempty" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if err := tc.sche.Cancel(strconv.Itoa(int(req.ID))); err != nil {
 		c.Error(err)
+		if errors.Is(err, scheduler.ErrTaskNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
 }
+
+func (tc *TaskController) simulate(c *gin.Context) {
+	var req struct {
+		Workers int `json:"workers,omitempty" binding:"required"`
+		// Sort is one of fifo, priority and deadline
+		Sort      string                    `json:"sort,omitempty"`
+		Synthetic *scheduler.WorkloadConfig `json:"synthetic,omitempty"`
+		Seed      int64                     `json:"seed,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	config := scheduler.SimulationConfig{Workers: req.Workers, Seed: req.Seed}
+	switch req.Sort {
+	case "", "fifo":
+	case "priority":
+		config.Compare = scheduler.CompareByPriority
+	case "deadline":
+		config.Compare = scheduler.CompareByDeadline
+	default:
+		c.Error(fmt.Errorf("unknown sort %q", req.Sort))
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	// the task history is replayed without a synthetic workload
+	var workload scheduler.Workload
+	if req.Synthetic != nil {
+		workload = scheduler.SyntheticWorkload(*req.Synthetic)
+	} else {
+		tasks, err := model.SelectHistory(tc.db)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
+			return
+		}
+
+		records := make([]scheduler.Record, 0, len(tasks))
+		for _, t := range tasks {
+			records = append(records, scheduler.Record{
+				ID:       strconv.Itoa(int(t.ID)),
+				Created:  t.CreateTime,
+				Started:  t.StartTime,
+				Finished: t.FinishedTime,
+				Failed:   t.State == "Error",
+			})
+		}
+		workload = scheduler.ReplayWorkload(records)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "report": scheduler.Simulate(workload, config)})
+}
+
+// invalidVersionError is returned when the version of a script to run has failed validation
+type invalidVersionError struct {
+	version *scriptmodel.Version
+}
+
+func (e *invalidVersionError) Error() string {
+	return fmt.Sprintf("version %d of script %d has failed validation", e.version.Version, e.version.ScriptID)
+}
+
+// source returns the source of the version of script to run and the version, the current
+// one is used if version is 0
+func (tc *TaskController) source(script *scriptmodel.Script, version int) (string, int, error) {
+	// the scripts saved before they were versioned have the version 0 and aren't validated
+	source := script.Script
+	if version == 0 {
+		version = script.Version
+	}
+	if version != 0 {
+		v, err := scriptmodel.SelectVersion(tc.db, script.ID, version)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if !v.Valid {
+			return "", 0, &invalidVersionError{version: v}
+		}
+
+		source = v.Script
+	}
+
+	realScript, err := url.QueryUnescape(source)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return realScript, version, nil
+}
+
+// resultPath returns the file the output of the task is written to
+func resultPath(taskID uint32) string {
+	return fmt.Sprintf("%d.txt", taskID)
+}
+
+// execute runs source of script as the task with taskID, the output is written to its
+// result file and the progress is recorded
+func (tc *TaskController) execute(ctx context.Context, run runner.Runner, script *scriptmodel.Script, taskID uint32, source string, params map[string]interface{}) error {
+	resultFile, err := os.Create(resultPath(taskID))
+	if err != nil {
+		return err
+	}
+	defer resultFile.Close()
+
+	checkpoint, err := scheduler.LoadCheckpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the protocol lines of the stdout are handled, the others are the output
+	stdout, w := io.Pipe()
+	scanned := make(chan error, 1)
+	go func() {
+		scanned <- scanOutput(stdout, resultFile, reportTo(ctx, func(pct float64, message string) {
+			if err := model.TaskProgress(tc.db, taskID, pct, message); err != nil {
+				log.Println(err)
+			}
+		}))
+	}()
+
+	err = run.Run(ctx, runner.Job{
+		TaskID:     taskID,
+		Source:     source,
+		Params:     params,
+		Checkpoint: checkpoint,
+		Host:       tc.hostAPI(script, taskID),
+		Stdout:     w,
+		Stderr:     log.Writer(),
+	})
+	w.Close()
+	scanErr := <-scanned
+
+	if err != nil {
+		return err
+	}
+
+	return scanErr
+}
+
+// store uploads the output of the task with taskID, and the result next to it if there is one
+func (tc *TaskController) store(taskID uint32, result interface{}) error {
+	info, err := tc.minioClient.FPutObject(context.Background(), bucketName, resultPath(taskID), resultPath(taskID), minio.PutObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	log.Print(info)
+
+	// the embedded scripts return a structured result, stored next to the output
+	if result != nil {
+		return tc.putResult(taskID, result)
+	}
+
+	return nil
+}
+
+// putResult stores the result of the task as JSON in <id>.json
+func (tc *TaskController) putResult(taskID uint32, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = tc.minioClient.PutObject(context.Background(), bucketName, fmt.Sprintf("%d.json", taskID),
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	return err
+}
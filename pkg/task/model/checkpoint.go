@@ -0,0 +1,114 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/silverswords/cerebus/pkg/scheduler"
+)
+
+const CheckpointTableName = "task_checkpoints"
+
+const (
+	postgresCheckpointCreateTable = iota
+	postgresCheckpointAlterTable
+	postgresCheckpointSave
+	postgresCheckpointLoad
+	postgresCheckpointDelete
+	postgresCheckpointPurge
+)
+
+var checkpointSQLString = map[int]string{
+	postgresCheckpointCreateTable: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+		task_id VARCHAR(50) PRIMARY KEY,
+		attempt INT NOT NULL DEFAULT 0,
+		data BYTEA NOT NULL,
+		update_time TIMESTAMP NOT NULL DEFAULT timestamp '2000-01-01 00:00:00'
+	);`, SchemaName, CheckpointTableName),
+	postgresCheckpointAlterTable: fmt.Sprintf(`ALTER TABLE %s.%s
+		ADD COLUMN IF NOT EXISTS attempt INT NOT NULL DEFAULT 0;`, SchemaName, CheckpointTableName),
+	postgresCheckpointSave: fmt.Sprintf(`INSERT INTO %s.%s (task_id, attempt, data, update_time) VALUES ($1, $2, $3, current_timestamp)
+		ON CONFLICT (task_id) DO UPDATE SET attempt = EXCLUDED.attempt, data = EXCLUDED.data, update_time = EXCLUDED.update_time`, SchemaName, CheckpointTableName),
+	postgresCheckpointLoad:   fmt.Sprintf(`SELECT attempt, data FROM %s.%s WHERE task_id = $1`, SchemaName, CheckpointTableName),
+	postgresCheckpointDelete: fmt.Sprintf(`DELETE FROM %s.%s WHERE task_id = $1`, SchemaName, CheckpointTableName),
+	postgresCheckpointPurge: fmt.Sprintf(`DELETE FROM %s.%s WHERE task_id NOT IN
+		(SELECT CAST(id AS VARCHAR) FROM %s.%s WHERE state = 'Running')`, SchemaName, CheckpointTableName, SchemaName, TableName),
+}
+
+// CheckpointStore keeps the checkpoints of the tasks in Postgres, next to the tasks
+type CheckpointStore struct {
+	db *sql.DB
+}
+
+func NewCheckpointStore(db *sql.DB) *CheckpointStore {
+	return &CheckpointStore{
+		db: db,
+	}
+}
+
+func CreateCheckpointTable(db *sql.DB) error {
+	_, err := db.Exec(checkpointSQLString[postgresCheckpointCreateTable])
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(checkpointSQLString[postgresCheckpointAlterTable])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeCheckpoints deletes the checkpoints of the tasks aren't running, such as the ones
+// left by the tasks without a task row, they won't be resumed
+func PurgeCheckpoints(db *sql.DB) error {
+	_, err := db.Exec(checkpointSQLString[postgresCheckpointPurge])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cs *CheckpointStore) Save(ctx context.Context, id string, c scheduler.Checkpoint) error {
+	result, err := cs.db.ExecContext(ctx, checkpointSQLString[postgresCheckpointSave], id, c.Attempt, c.Data)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid insert")
+	}
+
+	return nil
+}
+
+func (cs *CheckpointStore) Load(ctx context.Context, id string) (*scheduler.Checkpoint, error) {
+	c := &scheduler.Checkpoint{}
+	row := cs.db.QueryRowContext(ctx, checkpointSQLString[postgresCheckpointLoad], id)
+	if err := row.Scan(&c.Attempt, &c.Data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (cs *CheckpointStore) Delete(ctx context.Context, id string) error {
+	_, err := cs.db.ExecContext(ctx, checkpointSQLString[postgresCheckpointDelete], id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -8,16 +8,22 @@ import (
 )
 
 type Task struct {
-	ID           uint32    `json:"id,omitempty"`
-	Name         string    `json:"name,omitempty"`
-	ScriptID     uint32    `json:"script_id,omitempty"`
-	ScriptName   string    `json:"script_name,omitempty"`
-	ScriptType   string    `json:"script_type,omitempty"`
-	State        string    `json:"state,omitempty"`
-	Error        string    `json:"error,omitempty"`
-	StartTime    time.Time `json:"start_time,omitempty"`
-	FinishedTime time.Time `json:"finished_time,omitempty"`
-	CreateTime   time.Time `json:"create_time,omitempty"`
+	ID            uint32    `json:"id,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	ScriptID      uint32    `json:"script_id,omitempty"`
+	ScriptVersion int       `json:"script_version"`
+	ParentID      uint32    `json:"parent_id,omitempty"`
+	ScriptName    string    `json:"script_name,omitempty"`
+	ScriptType    string    `json:"script_type,omitempty"`
+	State         string    `json:"state,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Progress      float64   `json:"progress"`
+	ProgressMsg   string    `json:"progress_message,omitempty"`
+	StartTime     time.Time `json:"start_time,omitempty"`
+	FinishedTime  time.Time `json:"finished_time,omitempty"`
+	CreateTime    time.Time `json:"create_time,omitempty"`
+	// Spec is the JSON of the task spec the task is scheduled by, without the id
+	Spec string `json:"-"`
 }
 
 const (
@@ -28,12 +34,20 @@ const (
 const (
 	postgresTaskCreateDatabase = iota
 	postgresTaskCreateTable
+	postgresTaskAlterTable
 	postgresTaskInsertTask
 	postgresTaskSelectID
 	postgresTaskSelectAll
 	postgresTaskRun
 	postgresTaskFinish
 	postgresTaskError
+	postgresTaskReject
+	postgresTaskProgress
+	postgresTaskCancel
+	postgresTaskExpire
+	postgresTaskShed
+	postgresTaskSelectHistory
+	postgresTaskSelectRunning
 )
 
 var TaskSQLString = map[int]string{
@@ -42,18 +56,38 @@ var TaskSQLString = map[int]string{
 		id SERIAL PRIMARY KEY,
 		name VARCHAR(50) UNIQUE NOT NULL ,
 		script_id INT NOT NULL,
+		script_version INT NOT NULL DEFAULT 0,
+		parent_id INT NOT NULL DEFAULT 0,
 		state VARCHAR(20) NOT NULL,
 		error TEXT NOT NULL DEFAULT '',
+		progress REAL NOT NULL DEFAULT 0,
+		progress_message TEXT NOT NULL DEFAULT '',
 		start_time TIMESTAMP NOT NULL DEFAULT timestamp '2000-01-01 00:00:00',
 		finished_time TIMESTAMP NOT NULL  DEFAULT timestamp '2000-01-01 00:00:00',
-		create_time TIMESTAMP NOT NULL DEFAULT timestamp '2000-01-01 00:00:00'
+		create_time TIMESTAMP NOT NULL DEFAULT timestamp '2000-01-01 00:00:00',
+		spec TEXT NOT NULL DEFAULT ''
 	);`, SchemaName, TableName),
-	postgresTaskInsertTask: fmt.Sprintf(`INSERT INTO %s.%s (name, script_id, state, create_time) VALUES ($1, $2, 'Pending', current_timestamp);`, SchemaName, TableName),
-	postgresTaskSelectAll:  fmt.Sprintf(`SELECT tasks.id, tasks.name, tasks.script_id, scripts.name as script_name, scripts.type, tasks.state, tasks.error, tasks.start_time, tasks.finished_time, tasks.create_time FROM %s.%s LEFT JOIN project.scripts ON scripts.id = tasks.script_id;`, SchemaName, TableName),
+	postgresTaskAlterTable: fmt.Sprintf(`ALTER TABLE %s.%s
+		ADD COLUMN IF NOT EXISTS progress REAL NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS progress_message TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS parent_id INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS script_version INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS spec TEXT NOT NULL DEFAULT '';`, SchemaName, TableName),
+	postgresTaskInsertTask: fmt.Sprintf(`INSERT INTO %s.%s (name, script_id, script_version, parent_id, spec, state, create_time) VALUES ($1, $2, $3, $4, $5, 'Pending', current_timestamp);`, SchemaName, TableName),
+	postgresTaskSelectAll:  fmt.Sprintf(`SELECT tasks.id, tasks.name, tasks.script_id, tasks.script_version, tasks.parent_id, scripts.name as script_name, scripts.type, tasks.state, tasks.error, tasks.progress, tasks.progress_message, tasks.start_time, tasks.finished_time, tasks.create_time FROM %s.%s LEFT JOIN project.scripts ON scripts.id = tasks.script_id;`, SchemaName, TableName),
 	postgresTaskSelectID:   fmt.Sprintf(`SELECT id FROM %s.%s WHERE name = $1`, SchemaName, TableName),
 	postgresTaskRun:        fmt.Sprintf(`UPDATE %s.%s SET state = 'Running', start_time = current_timestamp WHERE id = $1`, SchemaName, TableName),
-	postgresTaskFinish:     fmt.Sprintf(`UPDATE %s.%s SET state = 'Finished', finished_time = current_timestamp WHERE id = $1`, SchemaName, TableName),
+	postgresTaskFinish:     fmt.Sprintf(`UPDATE %s.%s SET state = 'Finished', progress = 100, finished_time = current_timestamp WHERE id = $1`, SchemaName, TableName),
 	postgresTaskError:      fmt.Sprintf(`UPDATE %s.%s SET state = 'Error', error = $1, finished_time = current_timestamp WHERE id = $2`, SchemaName, TableName),
+	postgresTaskReject:     fmt.Sprintf(`UPDATE %s.%s SET state = 'Rejected', error = $1, finished_time = current_timestamp WHERE id = $2`, SchemaName, TableName),
+	postgresTaskProgress:   fmt.Sprintf(`UPDATE %s.%s SET progress = $1, progress_message = $2 WHERE id = $3`, SchemaName, TableName),
+	postgresTaskCancel:     fmt.Sprintf(`UPDATE %s.%s SET state = 'Cancelled', finished_time = current_timestamp WHERE id = $1`, SchemaName, TableName),
+	postgresTaskExpire:     fmt.Sprintf(`UPDATE %s.%s SET state = 'Expired', error = $1, finished_time = current_timestamp WHERE id = $2`, SchemaName, TableName),
+	postgresTaskShed:       fmt.Sprintf(`UPDATE %s.%s SET state = 'Shed', error = $1, finished_time = current_timestamp WHERE id = $2`, SchemaName, TableName),
+	postgresTaskSelectHistory: fmt.Sprintf(`SELECT id, state, create_time, start_time, finished_time FROM %s.%s
+		WHERE state IN ('Finished', 'Error') AND finished_time >= start_time ORDER BY create_time;`, SchemaName, TableName),
+	postgresTaskSelectRunning: fmt.Sprintf(`SELECT id, name, script_id, script_version, parent_id, spec FROM %s.%s
+		WHERE state = 'Running' ORDER BY id;`, SchemaName, TableName),
 }
 
 func CreateSchema(db *sql.DB) error {
@@ -71,11 +105,16 @@ func CreateTable(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec(TaskSQLString[postgresTaskAlterTable])
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func InsertTask(db *sql.DB, name string, scriptID uint32) error {
-	result, err := db.Exec(TaskSQLString[postgresTaskInsertTask], name, scriptID)
+func InsertTask(db *sql.DB, name string, scriptID uint32, scriptVersion int, parentID uint32, spec string) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskInsertTask], name, scriptID, scriptVersion, parentID, spec)
 	if err != nil {
 		return err
 	}
@@ -96,14 +135,18 @@ func SelectTasks(db *sql.DB) ([]*Task, error) {
 	var (
 		Tasks []*Task
 
-		ID         uint32
-		Name       string
-		ScriptID   uint32
-		ScriptName string
-		ScriptType string
+		ID            uint32
+		Name          string
+		ScriptID      uint32
+		ScriptVersion int
+		ParentID      uint32
+		ScriptName    string
+		ScriptType    string
 
 		State        string
 		Error        string
+		Progress     float64
+		ProgressMsg  string
 		StartTime    time.Time
 		FinishedTime time.Time
 		CreateTime   time.Time
@@ -117,21 +160,25 @@ func SelectTasks(db *sql.DB) ([]*Task, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		if err := rows.Scan(&ID, &Name, &ScriptID, &ScriptName, &ScriptType, &State, &Error, &StartTime, &FinishedTime, &CreateTime); err != nil {
+		if err := rows.Scan(&ID, &Name, &ScriptID, &ScriptVersion, &ParentID, &ScriptName, &ScriptType, &State, &Error, &Progress, &ProgressMsg, &StartTime, &FinishedTime, &CreateTime); err != nil {
 			return nil, err
 		}
 
 		Task := &Task{
-			ID:           ID,
-			Name:         Name,
-			ScriptID:     ScriptID,
-			ScriptName:   ScriptName,
-			ScriptType:   ScriptType,
-			State:        State,
-			Error:        Error,
-			StartTime:    StartTime,
-			FinishedTime: FinishedTime,
-			CreateTime:   CreateTime,
+			ID:            ID,
+			Name:          Name,
+			ScriptID:      ScriptID,
+			ScriptVersion: ScriptVersion,
+			ParentID:      ParentID,
+			ScriptName:    ScriptName,
+			ScriptType:    ScriptType,
+			State:         State,
+			Error:         Error,
+			Progress:      Progress,
+			ProgressMsg:   ProgressMsg,
+			StartTime:     StartTime,
+			FinishedTime:  FinishedTime,
+			CreateTime:    CreateTime,
 		}
 
 		Tasks = append(Tasks, Task)
@@ -186,8 +233,80 @@ func TaskFinish(db *sql.DB, id uint32) error {
 	return nil
 }
 
-func TaskError(db *sql.DB, id uint32, err error) error {
-	result, err := db.Exec(TaskSQLString[postgresTaskFinish], id, err.Error())
+func TaskError(db *sql.DB, id uint32, taskErr error) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskError], taskErr.Error(), id)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid update")
+	}
+
+	return nil
+}
+
+func TaskReject(db *sql.DB, id uint32, reason error) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskReject], reason.Error(), id)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid update")
+	}
+
+	return nil
+}
+
+func TaskProgress(db *sql.DB, id uint32, progress float64, message string) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskProgress], progress, message, id)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid update")
+	}
+
+	return nil
+}
+
+func TaskCancel(db *sql.DB, id uint32) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskCancel], id)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid update")
+	}
+
+	return nil
+}
+
+func TaskExpire(db *sql.DB, id uint32, reason error) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskExpire], reason.Error(), id)
 	if err != nil {
 		return err
 	}
@@ -203,3 +322,66 @@ func TaskError(db *sql.DB, id uint32, err error) error {
 
 	return nil
 }
+
+func TaskShed(db *sql.DB, id uint32, reason error) error {
+	result, err := db.Exec(TaskSQLString[postgresTaskShed], reason.Error(), id)
+	if err != nil {
+		return err
+	}
+
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if num == 0 {
+		return errors.New("invalid update")
+	}
+
+	return nil
+}
+
+func SelectHistory(db *sql.DB) ([]*Task, error) {
+	var Tasks []*Task
+
+	rows, err := db.Query(TaskSQLString[postgresTaskSelectHistory])
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		Task := &Task{}
+		if err := rows.Scan(&Task.ID, &Task.State, &Task.CreateTime, &Task.StartTime, &Task.FinishedTime); err != nil {
+			return nil, err
+		}
+
+		Tasks = append(Tasks, Task)
+	}
+
+	return Tasks, rows.Err()
+}
+
+// SelectRunning returns the tasks were running when the scheduler stopped, with their specs
+func SelectRunning(db *sql.DB) ([]*Task, error) {
+	var Tasks []*Task
+
+	rows, err := db.Query(TaskSQLString[postgresTaskSelectRunning])
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		Task := &Task{}
+		if err := rows.Scan(&Task.ID, &Task.Name, &Task.ScriptID, &Task.ScriptVersion, &Task.ParentID, &Task.Spec); err != nil {
+			return nil, err
+		}
+
+		Tasks = append(Tasks, Task)
+	}
+
+	return Tasks, rows.Err()
+}